@@ -0,0 +1,48 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package proto
+
+import (
+	"io"
+	"syscall"
+)
+
+// peek looks at the socket without blocking or
+// taking a byte off of it
+func peek(C syscall.Conn) error {
+	RC, err := C.SyscallConn()
+
+	if err != nil {
+		return err
+	}
+
+	var n int
+	var rerr error
+
+	err = RC.Read(func(fd uintptr) bool {
+		n, _, rerr = syscall.Recvfrom(
+			int(fd),
+			make([]byte, 1),
+			syscall.MSG_PEEK|syscall.MSG_DONTWAIT,
+		)
+
+		return true
+	})
+
+	switch {
+	case err != nil:
+		return err
+
+	case rerr == syscall.EAGAIN || rerr == syscall.EWOULDBLOCK:
+		return nil
+
+	case rerr != nil:
+		return rerr
+
+	case n > 0:
+		return ErrUnexpectedBytes
+	}
+
+	return io.EOF
+}
@@ -0,0 +1,48 @@
+package proto
+
+import (
+	"io"
+)
+
+// BatchWriter is implemented by message writers
+// that can send whole messages in a single write,
+// WriteMessage and WriteMessages use it when they can
+type BatchWriter interface {
+	WriteMessage([]byte) (int, error)
+	WriteMessages(...[]byte) (int, error)
+}
+
+// WriteMessage writes a whole message through the
+// protocol, in a single write if the protocol can
+func (c *Conn) WriteMessage(b []byte) (int, error) {
+	return WriteMessage(c.W, b)
+}
+
+// WriteMessages writes a batch of messages through
+// the protocol, in a single write if the protocol can
+func (c *Conn) WriteMessages(msgs ...[]byte) (int, error) {
+	return WriteMessages(c.W, msgs...)
+}
+
+// WriteMessages writes every message to W, a
+// BatchWriter sends them all in a single write.
+// Returns the count of message bytes written
+func WriteMessages(W io.Writer, msgs ...[]byte) (int, error) {
+	if bw, ok := W.(BatchWriter); ok {
+		return bw.WriteMessages(msgs...)
+	}
+
+	S := 0
+
+	for _, m := range msgs {
+		n, err := WriteMessage(W, m)
+
+		S += n
+
+		if err != nil {
+			return S, err
+		}
+	}
+
+	return S, nil
+}
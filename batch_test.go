@@ -0,0 +1,83 @@
+package proto_test
+
+import (
+	"bytes"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/crc"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestWriteMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	// qik writers batch, crc writers do not
+	for _, p := range []proto.Protocol{qik.NewProtocol(), crc.NewProtocol(qik.NewProtocol())} {
+		B := bytes.NewBuffer(nil)
+		W, R := proto.Wrap(p, B, B)
+
+		n, err := proto.WriteMessages(W, []byte("one"), nil, []byte("three"))
+
+		assert.Nil(
+			err,
+			"bytes not written",
+		)
+
+		assert.Equal(
+			8,
+			n,
+			"the message bytes were counted",
+		)
+
+		for _, m := range []string{"one", "", "three"} {
+			Received, err := proto.ReadMessage(R)
+
+			assert.Nil(
+				err,
+				"bytes not read",
+			)
+
+			assert.Equal(
+				m,
+				string(Received),
+				"bytes match",
+			)
+		}
+	}
+}
+
+func TestConnWriteMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	a, b := net.Pipe()
+
+	A := proto.WrapConn(qik.NewProtocol(), a)
+	B := proto.WrapConn(qik.NewProtocol(), b)
+	defer A.Close()
+	defer B.Close()
+
+	assert.Implements(
+		(*proto.BatchWriter)(nil),
+		A,
+		"connections write batches",
+	)
+
+	go A.(proto.BatchWriter).WriteMessages([]byte("hello"), []byte("world"))
+
+	for _, m := range []string{"hello", "world"} {
+		Received, err := proto.ReadMessage(B)
+
+		assert.Nil(
+			err,
+			"bytes not read",
+		)
+
+		assert.Equal(
+			m,
+			string(Received),
+			"bytes match",
+		)
+	}
+}
@@ -0,0 +1,88 @@
+package proto
+
+import (
+	"io"
+	"sync"
+)
+
+const (
+	// DefaultBufferSize the capacity new
+	// pooled buffers start out with
+	DefaultBufferSize = 512
+	// MaxPooledBufferSize buffers grown past this
+	// are left to the garbage collector on Release
+	// so one large message does not pin its memory
+	MaxPooledBufferSize = 1 << 20
+)
+
+var (
+	bufferPool = sync.Pool{
+		New: func() interface{} {
+			b := Buffer{
+				B: make([]byte, 0, DefaultBufferSize),
+			}
+
+			return &b
+		},
+	}
+)
+
+// Buffer a message buffer taken from a pool,
+// the caller owns it until calling Release
+type Buffer struct {
+	B []byte
+}
+
+// GetBuffer takes an empty buffer from the pool
+func GetBuffer() *Buffer {
+	b := bufferPool.Get().(*Buffer)
+	b.B = b.B[:0]
+
+	return b
+}
+
+// ReadMessageBuffer reads a message like ReadMessage
+// into a pooled buffer. The buffer must be released
+// once the message is no longer used, on error it
+// is released already and nil is returned
+func ReadMessageBuffer(R io.Reader) (*Buffer, error) {
+	b := GetBuffer()
+
+	err := b.ReadMessage(R)
+
+	if err != nil {
+		b.Release()
+
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// ReadMessage replaces the contents of the
+// buffer with the next message read off of R
+func (b *Buffer) ReadMessage(R io.Reader) error {
+	B, err := ReadMessageInto(b.B[:0], R)
+
+	b.B = B
+
+	return err
+}
+
+// Bytes the message, it is only valid
+// until the buffer is released
+func (b *Buffer) Bytes() []byte {
+	return b.B
+}
+
+// Release puts the buffer back into the pool,
+// neither it nor its bytes may be used after
+func (b *Buffer) Release() {
+	if cap(b.B) > MaxPooledBufferSize {
+		return
+	}
+
+	b.B = b.B[:0]
+
+	bufferPool.Put(b)
+}
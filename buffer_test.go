@@ -0,0 +1,141 @@
+package proto_test
+
+import (
+	"bytes"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestReadMessageInto(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+	W, R := proto.Wrap(qik.NewProtocol(), B, B)
+
+	Large := bytes.Repeat([]byte("large"), 1000)
+
+	proto.WriteMessage(W, []byte("hello"))
+	proto.WriteMessage(W, Large)
+	proto.WriteMessage(W, []byte("again"))
+
+	Dst := make([]byte, 0, 64)
+
+	Received, err := proto.ReadMessageInto(Dst, R)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"hello",
+		string(Received),
+		"bytes match",
+	)
+
+	assert.Equal(
+		&Dst[:1][0],
+		&Received[0],
+		"the message was read into dst",
+	)
+
+	Received, err = proto.ReadMessageInto(Received[:0], R)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		Large,
+		Received,
+		"dst grew to hold the message",
+	)
+
+	Received, err = proto.ReadMessageInto([]byte("prefix "), R)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"prefix again",
+		string(Received),
+		"the message is appended to dst",
+	)
+}
+
+func TestReadMessageBuffer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	B := bytes.NewBuffer(nil)
+	W, R := proto.Wrap(qik.NewProtocol(), B, B)
+
+	proto.WriteMessage(W, []byte("hello"))
+	proto.WriteMessage(W, make([]byte, 101))
+
+	b, err := proto.ReadMessageBuffer(R)
+
+	require.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"hello",
+		string(b.Bytes()),
+		"bytes match",
+	)
+
+	b.Release()
+
+	_, err = proto.ReadMessageBuffer(proto.LimitMessages(R, 100))
+
+	assert.Equal(
+		proto.ErrMessageTooLarge,
+		err,
+		"the buffer is released on error",
+	)
+
+	b = proto.GetBuffer()
+
+	assert.Empty(
+		b.Bytes(),
+		"buffers from the pool are empty",
+	)
+
+	b.Release()
+}
+
+func TestReadMessageIntoAllocs(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+	W := qik.NewWriter(B)
+
+	proto.WriteMessage(W, make([]byte, 1000))
+
+	Encoded := B.Bytes()
+
+	In := bytes.NewReader(Encoded)
+	R := qik.NewReader(In)
+
+	Dst := make([]byte, 0, 1000)
+
+	Allocs := testing.AllocsPerRun(100, func() {
+		In.Reset(Encoded)
+
+		Dst, _ = proto.ReadMessageInto(Dst[:0], R)
+	})
+
+	assert.Equal(
+		float64(0),
+		Allocs,
+		"reading into a large enough dst does not allocate",
+	)
+}
@@ -0,0 +1,270 @@
+package proto
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFlushSize the buffered bytes that are
+	// flushed when FlushPolicy.Size is zero
+	DefaultFlushSize = 4096
+)
+
+// FlushPolicy decides when a BufferedWriter writes
+// out its buffer, whichever comes first. Flush
+// writes it out at any time
+type FlushPolicy struct {
+	// OnMessage flush at every end of message
+	OnMessage bool
+	// Size flush once this many bytes are
+	// buffered, DefaultFlushSize when zero
+	Size int
+	// Delay flush at most this long after a
+	// byte is buffered, zero means never
+	Delay time.Duration
+}
+
+// Flusher is implemented by writers that
+// buffer, such as a BufferedWriter
+type Flusher interface {
+	Flush() error
+}
+
+// BufferedProtocol buffers the writers of
+// a Protocol, see Buffered
+type BufferedProtocol struct {
+	P      Protocol
+	Policy FlushPolicy
+}
+
+// Buffered wraps a protocol so its writers collect
+// the framed bytes in a buffer and write them out
+// following the policy, small messages then share
+// a single write without turning off TCP_NODELAY
+func Buffered(p Protocol, Policy FlushPolicy) *BufferedProtocol {
+	b := BufferedProtocol{
+		P:      p,
+		Policy: Policy,
+	}
+
+	return &b
+}
+
+// Flush writes out anything the protocol writer
+// buffered, it does nothing for other protocols.
+// Close does not flush
+func (c *Conn) Flush() error {
+	if f, ok := c.W.(Flusher); ok {
+		return f.Flush()
+	}
+
+	return nil
+}
+
+// NewReader ...
+func (p *BufferedProtocol) NewReader(R io.Reader) io.Reader {
+	return p.P.NewReader(R)
+}
+
+// NewWriter ...
+func (p *BufferedProtocol) NewWriter(W io.Writer) io.Writer {
+	return NewBufferedWriter(p.P, W, p.Policy)
+}
+
+// BufferedWriter writes messages through the protocol
+// writer P, which writes into Buff instead of W. It
+// is safe to flush from another goroutine
+type BufferedWriter struct {
+	W      io.Writer
+	P      io.Writer
+	Policy FlushPolicy
+	Buff   []byte
+
+	mu    sync.Mutex
+	timer *time.Timer
+	timed bool
+	err   error
+}
+
+// NewBufferedWriter creates a writer for the protocol
+// that buffers what it writes to W
+func NewBufferedWriter(p Protocol, W io.Writer, Policy FlushPolicy) *BufferedWriter {
+	if Policy.Size <= 0 {
+		Policy.Size = DefaultFlushSize
+	}
+
+	w := BufferedWriter{
+		W:      W,
+		Policy: Policy,
+	}
+
+	w.P = p.NewWriter((*bufferSink)(&w))
+
+	return &w
+}
+
+// Write writes through the protocol writer,
+// writing the empty buffer ends the message
+func (w *BufferedWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	n, err := w.P.Write(b)
+
+	if err != nil {
+		return n, err
+	}
+
+	if len(b) == 0 && w.Policy.OnMessage {
+		return n, w.flush()
+	}
+
+	return n, nil
+}
+
+// WriteMessage ...
+func (w *BufferedWriter) WriteMessage(b []byte) (int, error) {
+	return w.WriteMessages(b)
+}
+
+// WriteMessages writes the messages through the
+// protocol writer, in a single write if it can
+func (w *BufferedWriter) WriteMessages(msgs ...[]byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	n, err := WriteMessages(w.P, msgs...)
+
+	if err != nil {
+		return n, err
+	}
+
+	if w.Policy.OnMessage {
+		return n, w.flush()
+	}
+
+	return n, nil
+}
+
+// Flush writes out the buffered bytes
+func (w *BufferedWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.flush()
+}
+
+// Buffered the count of bytes waiting
+// to be written
+func (w *BufferedWriter) Buffered() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return len(w.Buff)
+}
+
+// flush writes out the buffer, a failed write
+// fails every write after it
+func (w *BufferedWriter) flush() error {
+	if w.timed {
+		w.timer.Stop()
+		w.timed = false
+	}
+
+	if w.err != nil {
+		return w.err
+	}
+
+	if len(w.Buff) == 0 {
+		return nil
+	}
+
+	_, err := w.W.Write(w.Buff)
+
+	w.Buff = w.Buff[:0]
+
+	if err != nil {
+		w.err = err
+	}
+
+	return err
+}
+
+// schedule starts the Delay timer if it
+// is not already running
+func (w *BufferedWriter) schedule() {
+	if w.Policy.Delay <= 0 || w.timed {
+		return
+	}
+
+	w.timed = true
+
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.Policy.Delay, w.expire)
+
+		return
+	}
+
+	w.timer.Reset(w.Policy.Delay)
+}
+
+// expire flushes once the Delay is up, an error
+// is returned by the next write
+func (w *BufferedWriter) expire() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.timed = false
+
+	w.flush()
+}
+
+// bufferSink is what the protocol writer of a
+// BufferedWriter writes into, it is only written
+// to while the BufferedWriter is locked
+type bufferSink BufferedWriter
+
+func (s *bufferSink) Write(b []byte) (int, error) {
+	w := (*BufferedWriter)(s)
+
+	if len(w.Buff)+len(b) > w.Policy.Size {
+		err := w.flush()
+
+		if err != nil {
+			return 0, err
+		}
+
+		// too large to be worth copying
+		if len(b) >= w.Policy.Size {
+			n, err := w.W.Write(b)
+
+			if err != nil {
+				w.err = err
+			}
+
+			return n, err
+		}
+	}
+
+	if len(b) > 0 && len(w.Buff) == 0 {
+		w.schedule()
+	}
+
+	w.Buff = append(w.Buff, b...)
+
+	if len(w.Buff) >= w.Policy.Size {
+		return len(b), w.flush()
+	}
+
+	return len(b), nil
+}
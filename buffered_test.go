@@ -0,0 +1,240 @@
+package proto_test
+
+import (
+	"bytes"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingWriter counts the writes that reach
+// it, it is safe to write from a timer
+type countingWriter struct {
+	mu     sync.Mutex
+	B      bytes.Buffer
+	Writes int
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.Writes++
+
+	return w.B.Write(b)
+}
+
+func (w *countingWriter) Count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.Writes
+}
+
+func TestBufferedSize(t *testing.T) {
+	assert := assert.New(t)
+
+	C := countingWriter{}
+
+	p := proto.Buffered(qik.NewProtocol(), proto.FlushPolicy{
+		Size: 64,
+	})
+
+	W := p.NewWriter(&C)
+
+	for _, m := range []string{"one", "two", "three"} {
+		proto.WriteMessage(W, []byte(m))
+	}
+
+	assert.Equal(
+		0,
+		C.Count(),
+		"small messages are buffered",
+	)
+
+	proto.WriteMessage(W, make([]byte, 100))
+
+	assert.Equal(
+		2,
+		C.Count(),
+		"the buffer and the large message were written",
+	)
+
+	proto.WriteMessage(W, []byte("four"))
+
+	err := W.(proto.Flusher).Flush()
+
+	assert.Nil(
+		err,
+		"bytes not flushed",
+	)
+
+	assert.Equal(
+		3,
+		C.Count(),
+		"flush wrote the rest",
+	)
+
+	R := p.NewReader(&C.B)
+
+	for _, m := range []string{"one", "two", "three", string(make([]byte, 100)), "four"} {
+		Received, err := proto.ReadMessage(R)
+
+		assert.Nil(
+			err,
+			"bytes not read",
+		)
+
+		assert.Equal(
+			m,
+			string(Received),
+			"bytes match",
+		)
+	}
+}
+
+func TestBufferedOnMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	C := countingWriter{}
+
+	W := proto.Buffered(qik.NewProtocol(), proto.FlushPolicy{
+		OnMessage: true,
+	}).NewWriter(&C)
+
+	W.Write([]byte("hel"))
+	W.Write([]byte("lo"))
+
+	assert.Equal(
+		0,
+		C.Count(),
+		"the message is not over",
+	)
+
+	W.Write(nil)
+
+	assert.Equal(
+		1,
+		C.Count(),
+		"the message went out in one write",
+	)
+
+	proto.WriteMessages(W, []byte("one"), []byte("two"))
+
+	assert.Equal(
+		2,
+		C.Count(),
+		"the batch went out in one write",
+	)
+}
+
+func TestBufferedDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	C := countingWriter{}
+
+	W := proto.Buffered(qik.NewProtocol(), proto.FlushPolicy{
+		Delay: 10 * time.Millisecond,
+	}).NewWriter(&C)
+
+	proto.WriteMessage(W, []byte("one"))
+	proto.WriteMessage(W, []byte("two"))
+
+	assert.Equal(
+		0,
+		C.Count(),
+		"the messages wait for the delay",
+	)
+
+	assert.Eventually(
+		func() bool {
+			return C.Count() == 1
+		},
+		time.Second,
+		time.Millisecond,
+		"both messages went out after the delay",
+	)
+}
+
+func TestBufferedConn(t *testing.T) {
+	assert := assert.New(t)
+
+	a, b := net.Pipe()
+
+	p := proto.Buffered(qik.NewProtocol(), proto.FlushPolicy{})
+
+	A := proto.WrapConn(p, a).(*proto.Conn)
+	B := proto.WrapConn(p, b)
+	defer A.Close()
+	defer B.Close()
+
+	A.WriteMessage([]byte("hello"))
+
+	go A.Flush()
+
+	Received, err := proto.ReadMessage(B)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"hello",
+		string(Received),
+		"the message went out on flush",
+	)
+}
+
+func TestBufferedServer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	S, addr, done := startServer(
+		t,
+		proto.HandlerFunc(func(w io.Writer, m []byte) {
+			w.Write(bytes.ToUpper(m))
+		}),
+		func(S *proto.Server) {
+			S.Protocol = proto.Buffered(qik.NewProtocol(), proto.FlushPolicy{})
+		},
+	)
+
+	c, err := net.Dial("tcp", addr)
+
+	require.Nil(
+		err,
+		"could not dial",
+	)
+	defer c.Close()
+
+	C := proto.WrapConn(qik.NewProtocol(), c)
+
+	proto.WriteMessage(C, []byte("hello"))
+
+	Received, err := proto.ReadMessage(C)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"HELLO",
+		string(Received),
+		"the server flushed the reply",
+	)
+
+	assert.Nil(
+		S.Close(),
+		"closed the server",
+	)
+
+	<-done
+}
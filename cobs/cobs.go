@@ -0,0 +1,404 @@
+package cobs
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/internal/flat"
+	"io"
+)
+
+const (
+	// Delimiter ends every frame, it
+	// never appears inside of one
+	Delimiter = 0x00
+	// MaxBlock the most data bytes a block
+	// carries, its code byte is 0xFF
+	MaxBlock = 254
+	// BufferSize the size of the read buffer
+	BufferSize = 512
+)
+
+var (
+	// ErrTruncated a frame ends in
+	// the middle of a block
+	ErrTruncated = fmt.Errorf(
+		"cobs: frame ends inside a block",
+	)
+)
+
+// Protocol frames messages with Consistent Overhead
+// Byte Stuffing. A frame is a run of blocks, each a
+// code byte and up to MaxBlock data bytes, ending
+// with a zero. The overhead is at most one byte in
+// every MaxBlock plus the delimiter
+type Protocol struct{}
+
+// NewReader ...
+func (p *Protocol) NewReader(R io.Reader) io.Reader {
+	return NewReader(R)
+}
+
+// NewWriter ...
+func (p *Protocol) NewWriter(W io.Writer) io.Writer {
+	return NewWriter(W)
+}
+
+// NewProtocol ...
+func NewProtocol() *Protocol {
+	p := Protocol{}
+
+	return &p
+}
+
+func init() {
+	proto.Register("cobs", func() proto.Protocol {
+		return NewProtocol()
+	})
+}
+
+// Reader read messages using this Reader. A block's
+// zero is held back in Zero until the next byte shows
+// it is not the delimiter. Empty frames are dropped,
+// messages past Max bytes are skipped and return
+// proto.ErrMessageTooLarge
+type Reader struct {
+	R       io.Reader
+	Buff    []byte
+	Pending []byte
+	Err     error
+	Count   int
+	Zero    bool
+	Started bool
+	Max     int
+	Size    int
+}
+
+// Writer encode messages using this Writer. The
+// code byte comes before a block's data, so a block
+// is held in Block until it is full, a zero is
+// written or the message ends
+type Writer struct {
+	W     io.Writer
+	Block []byte
+	Full  bool
+
+	flat flat.Buffer
+}
+
+// NewReader creates a new Reader that
+// will decode messages from an io.Reader
+func NewReader(R io.Reader) *Reader {
+	r := Reader{
+		R:    R,
+		Buff: make([]byte, BufferSize),
+	}
+
+	return &r
+}
+
+// NewWriter creates a new Writer that
+// will encode messages to an io.Writer
+func NewWriter(W io.Writer) *Writer {
+	w := Writer{
+		W:     W,
+		Block: make([]byte, 0, MaxBlock),
+	}
+
+	w.flat.Encode = w.message
+
+	return &w
+}
+
+// Read decodes bytes into b, it returns
+// proto.ErrEOM when it reaches a Delimiter
+func (r *Reader) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	for {
+		if len(r.Pending) == 0 {
+			if r.Err == io.EOF && r.Started {
+				return 0, io.ErrUnexpectedEOF
+			}
+
+			if r.Err != nil {
+				return 0, r.readErr()
+			}
+
+			r.fill()
+
+			continue
+		}
+
+		n, err := r.decode(b)
+
+		r.Size += n
+
+		if r.Max > 0 && r.Size > r.Max {
+			return 0, r.skip()
+		}
+
+		if err != nil {
+			r.Size = 0
+
+			return 0, err
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// SetMaxMessageSize ...
+func (r *Reader) SetMaxMessageSize(Max int) {
+	r.Max = Max
+}
+
+// readErr hands back the read error, only io.EOF
+// is kept so a read past a deadline can be retried
+func (r *Reader) readErr() error {
+	err := r.Err
+
+	if err != io.EOF {
+		r.Err = nil
+	}
+
+	return err
+}
+
+// fill reads more pending bytes
+func (r *Reader) fill() {
+	n, err := r.R.Read(r.Buff)
+
+	r.Pending = r.Buff[:n]
+	r.Err = err
+}
+
+// reset gets ready for the next frame
+func (r *Reader) reset() {
+	r.Count = 0
+	r.Zero = false
+	r.Started = false
+}
+
+// skip drops the rest of the frame,
+// the delimiter never appears in it
+func (r *Reader) skip() error {
+	for {
+		i := bytes.IndexByte(r.Pending, Delimiter)
+
+		if i >= 0 {
+			r.Pending = r.Pending[i+1:]
+			r.Size = 0
+			r.reset()
+
+			return proto.ErrMessageTooLarge
+		}
+
+		r.Pending = nil
+
+		if r.Err != nil {
+			return r.readErr()
+		}
+
+		r.fill()
+	}
+}
+
+// decode moves the pending bytes into b, the
+// bytes before a delimiter are returned first
+func (r *Reader) decode(b []byte) (int, error) {
+	n := 0
+
+	for len(r.Pending) > 0 {
+		if r.Count > 0 {
+			L := r.Count
+
+			if L > len(r.Pending) {
+				L = len(r.Pending)
+			}
+
+			if i := bytes.IndexByte(r.Pending[:L], Delimiter); i >= 0 {
+				L = i
+			}
+
+			if L == 0 {
+				if n > 0 {
+					return n, nil
+				}
+
+				r.Pending = r.Pending[1:]
+				r.reset()
+
+				return 0, ErrTruncated
+			}
+
+			if L > len(b)-n {
+				L = len(b) - n
+			}
+
+			if L == 0 {
+				return n, nil
+			}
+
+			copy(b[n:], r.Pending[:L])
+
+			r.Pending = r.Pending[L:]
+			r.Count -= L
+			n += L
+
+			continue
+		}
+
+		c := r.Pending[0]
+
+		if c == Delimiter {
+			if n > 0 {
+				return n, nil
+			}
+
+			r.Pending = r.Pending[1:]
+
+			Started := r.Started
+
+			r.reset()
+
+			if !Started {
+				continue
+			}
+
+			return 0, proto.ErrEOM
+		}
+
+		// the last block's zero was not the end
+		if r.Zero {
+			if n == len(b) {
+				return n, nil
+			}
+
+			b[n] = 0
+			n++
+
+			r.Zero = false
+		}
+
+		r.Pending = r.Pending[1:]
+		r.Started = true
+		r.Count = int(c) - 1
+		r.Zero = c != 0xFF
+	}
+
+	return n, nil
+}
+
+// Write encodes the bytes, writing the
+// empty buffer ends the message
+func (w *Writer) Write(b []byte) (int, error) {
+	var Flat []byte
+
+	if len(b) == 0 {
+		Flat = w.end(w.flat.Bytes())
+	} else {
+		Flat = w.encode(w.flat.Bytes(), b)
+	}
+
+	if len(Flat) == 0 {
+		return len(b), nil
+	}
+
+	_, err := w.flat.Write(w.W, Flat)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// WriteMessage writes the whole message
+// in a single write
+func (w *Writer) WriteMessage(b []byte) (int, error) {
+	return w.flat.WriteMessages(w.W, b)
+}
+
+// WriteMessages writes every message
+// in a single write
+func (w *Writer) WriteMessages(msgs ...[]byte) (int, error) {
+	return w.flat.WriteMessages(w.W, msgs...)
+}
+
+// message appends the whole message
+// and its delimiter
+func (w *Writer) message(Flat []byte, m []byte) ([]byte, error) {
+	return w.end(w.encode(Flat, m)), nil
+}
+
+// encode appends the blocks b completes to Flat,
+// the rest of b is kept in Block
+func (w *Writer) encode(Flat []byte, b []byte) []byte {
+	for len(b) > 0 {
+		L := len(b)
+
+		z := bytes.IndexByte(b, 0)
+
+		if z >= 0 {
+			L = z
+		}
+
+		Room := MaxBlock - len(w.Block)
+
+		if L >= Room {
+			Flat = append(Flat, 0xFF)
+			Flat = append(Flat, w.Block...)
+			Flat = append(Flat, b[:Room]...)
+
+			w.Block = w.Block[:0]
+			w.Full = true
+
+			b = b[Room:]
+
+			continue
+		}
+
+		w.Block = append(w.Block, b[:L]...)
+		w.Full = false
+
+		b = b[L:]
+
+		// the zero ends the block
+		if z >= 0 {
+			Flat = w.block(Flat)
+
+			b = b[1:]
+		}
+	}
+
+	return Flat
+}
+
+// end appends the last block and the delimiter,
+// a message ending on a full block needs no
+// block after it
+func (w *Writer) end(Flat []byte) []byte {
+	if !w.Full || len(w.Block) > 0 {
+		Flat = w.block(Flat)
+	}
+
+	w.Full = false
+
+	return append(Flat, Delimiter)
+}
+
+// block appends Block with its code byte
+func (w *Writer) block(Flat []byte) []byte {
+	Flat = append(Flat, byte(len(w.Block)+1))
+	Flat = append(Flat, w.Block...)
+
+	w.Block = w.Block[:0]
+	w.Full = false
+
+	return Flat
+}
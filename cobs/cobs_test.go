@@ -0,0 +1,290 @@
+package cobs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/johnmcconnell/proto"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"testing"
+	"testing/iotest"
+)
+
+// flaky fails its first read like a
+// read past a deadline
+type flaky struct {
+	R      io.Reader
+	Failed bool
+}
+
+func (f *flaky) Read(b []byte) (int, error) {
+	if !f.Failed {
+		f.Failed = true
+
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	return f.R.Read(b)
+}
+
+func randomBytes(S int) ([]byte, error) {
+	BS := make([]byte, S)
+
+	_, err := rand.Read(BS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return BS, err
+}
+
+// seq the bytes from a to b inclusive
+func seq(a, b int) []byte {
+	var BS []byte
+
+	for i := a; i <= b; i++ {
+		BS = append(BS, byte(i))
+	}
+
+	return BS
+}
+
+func join(bs ...[]byte) []byte {
+	return bytes.Join(bs, nil)
+}
+
+// vectors from the COBS paper and its Wikipedia article
+var vectors = []struct {
+	M []byte
+	E []byte
+}{
+	{[]byte{}, []byte{0x01, 0x00}},
+	{[]byte{0x00}, []byte{0x01, 0x01, 0x00}},
+	{[]byte{0x00, 0x00}, []byte{0x01, 0x01, 0x01, 0x00}},
+	{[]byte{0x00, 0x11, 0x00}, []byte{0x01, 0x02, 0x11, 0x01, 0x00}},
+	{[]byte{0x11, 0x22, 0x00, 0x33}, []byte{0x03, 0x11, 0x22, 0x02, 0x33, 0x00}},
+	{[]byte{0x11, 0x22, 0x33, 0x44}, []byte{0x05, 0x11, 0x22, 0x33, 0x44, 0x00}},
+	{[]byte{0x11, 0x00, 0x00, 0x00}, []byte{0x02, 0x11, 0x01, 0x01, 0x01, 0x00}},
+	{seq(0x01, 0xFE), join([]byte{0xFF}, seq(0x01, 0xFE), []byte{0x00})},
+	{seq(0x00, 0xFE), join([]byte{0x01, 0xFF}, seq(0x01, 0xFE), []byte{0x00})},
+	{seq(0x01, 0xFF), join([]byte{0xFF}, seq(0x01, 0xFE), []byte{0x02, 0xFF, 0x00})},
+	{join(seq(0x02, 0xFF), []byte{0x00}), join([]byte{0xFF}, seq(0x02, 0xFF), []byte{0x01, 0x01, 0x00})},
+	{join(seq(0x03, 0xFF), []byte{0x00, 0x01}), join([]byte{0xFE}, seq(0x03, 0xFF), []byte{0x02, 0x01, 0x00})},
+}
+
+func TestEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, v := range vectors {
+		B := bytes.NewBuffer(nil)
+
+		proto.WriteMessage(NewWriter(B), v.M)
+
+		assert.Equal(
+			v.E,
+			B.Bytes(),
+			"bytes match the vector",
+		)
+
+		// a byte at a time goes through Block
+		B.Reset()
+		W := NewWriter(B)
+
+		for i := range v.M {
+			W.Write(v.M[i : i+1])
+		}
+
+		W.Write(nil)
+
+		assert.Equal(
+			v.E,
+			B.Bytes(),
+			"bytes match the vector",
+		)
+	}
+}
+
+func TestDecoding(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, v := range vectors {
+		for _, R := range []io.Reader{bytes.NewReader(v.E), iotest.OneByteReader(bytes.NewReader(v.E))} {
+			Received, err := proto.ReadMessage(NewReader(R))
+
+			assert.Nil(
+				err,
+				"bytes not read",
+			)
+
+			assert.True(
+				bytes.Equal(v.M, Received),
+				"bytes match the vector",
+			)
+		}
+	}
+}
+
+func TestRandom(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+	W, R := proto.Wrap(NewProtocol(), B, B)
+
+	var Messages [][]byte
+
+	for _, S := range []int{0, 1, 253, 254, 255, 508, 10000, 100000} {
+		m, err := randomBytes(S)
+
+		assert.Nil(
+			err,
+			"could not create random bytes",
+		)
+
+		Messages = append(Messages, m)
+	}
+
+	proto.WriteMessages(W, Messages...)
+
+	Overhead := B.Len()
+	Max := 0
+
+	// at most one byte every MaxBlock, one
+	// for the last block and the delimiter
+	for _, m := range Messages {
+		Overhead -= len(m)
+		Max += len(m)/MaxBlock + 2
+	}
+
+	assert.True(
+		Overhead <= Max,
+		"the overhead is bounded",
+	)
+
+	for _, m := range Messages {
+		Received, err := proto.ReadMessage(R)
+
+		assert.Nil(
+			err,
+			"bytes not read",
+		)
+
+		assert.True(
+			bytes.Equal(m, Received),
+			"bytes match",
+		)
+	}
+}
+
+func TestFraming(t *testing.T) {
+	assert := assert.New(t)
+
+	// leading and repeated delimiters are empty
+	// frames, the third frame is cut short
+	In := []byte{0x00, 0x00, 0x03, 'h', 'i', 0x00, 0x00, 0x05, 'a', 0x00, 0x02, 'o', 0x00}
+
+	D := NewReader(bytes.NewReader(In))
+
+	Received, err := proto.ReadMessage(D)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"hi",
+		string(Received),
+		"empty frames are dropped",
+	)
+
+	_, err = proto.ReadMessage(D)
+
+	assert.Equal(
+		ErrTruncated,
+		err,
+		"the frame ends inside a block",
+	)
+
+	Received, err = proto.ReadMessage(D)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"o",
+		string(Received),
+		"the reader picks up at the next frame",
+	)
+
+	_, err = D.Read(make([]byte, 16))
+
+	assert.Equal(
+		io.EOF,
+		err,
+		"the stream is over",
+	)
+
+	_, err = proto.ReadMessage(NewReader(bytes.NewReader([]byte{0x03, 'h'})))
+
+	assert.Equal(
+		io.ErrUnexpectedEOF,
+		err,
+		"the stream ends inside a frame",
+	)
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+	W, R := proto.Wrap(NewProtocol(), B, B)
+
+	proto.WriteMessages(W, []byte("small"), make([]byte, 1000), []byte("again"))
+
+	R = proto.LimitMessages(R, 100)
+
+	for _, E := range []error{nil, proto.ErrMessageTooLarge, nil} {
+		_, err := proto.ReadMessage(R)
+
+		assert.Equal(
+			E,
+			err,
+			"messages past the max are skipped",
+		)
+	}
+}
+
+func TestReadAfterTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+
+	proto.WriteMessage(NewWriter(B), []byte("after"))
+
+	R := NewReader(&flaky{R: B})
+
+	_, err := proto.ReadMessage(R)
+
+	assert.Equal(
+		os.ErrDeadlineExceeded,
+		err,
+		"the read timed out",
+	)
+
+	Received, err := proto.ReadMessage(R)
+
+	assert.Nil(
+		err,
+		"the reader recovers from a timeout",
+	)
+
+	assert.Equal(
+		"after",
+		string(Received),
+		"bytes match",
+	)
+}
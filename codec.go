@@ -0,0 +1,150 @@
+package proto
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Codec turns Go values into message bodies and
+// back, see NewEncoder and NewDecoder
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(b []byte, v interface{}) error
+}
+
+var (
+	// JSON encodes values with encoding/json
+	JSON Codec = jsonCodec{}
+	// Gob encodes values with encoding/gob, every
+	// message carries its own type information
+	Gob Codec = gobCodec{}
+	// Binary encodes values that implement
+	// encoding.BinaryMarshaler and
+	// encoding.BinaryUnmarshaler, such as Message
+	Binary Codec = binaryCodec{}
+)
+
+// Encoder writes one value per message
+type Encoder struct {
+	W     io.Writer
+	Codec Codec
+}
+
+// Decoder reads one value per message,
+// Buff is reused between messages
+type Decoder struct {
+	R     io.Reader
+	Codec Codec
+	Buff  []byte
+}
+
+// NewEncoder creates an Encoder that writes
+// messages to W, a message writer
+func NewEncoder(W io.Writer, Codec Codec) *Encoder {
+	e := Encoder{
+		W:     W,
+		Codec: Codec,
+	}
+
+	return &e
+}
+
+// NewDecoder creates a Decoder that reads
+// messages from R, a message reader
+func NewDecoder(R io.Reader, Codec Codec) *Decoder {
+	d := Decoder{
+		R:     R,
+		Codec: Codec,
+	}
+
+	return &d
+}
+
+// Encode writes v as a single message
+func (e *Encoder) Encode(v interface{}) error {
+	B, err := e.Codec.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = WriteMessage(e.W, B)
+
+	return err
+}
+
+// Decode reads a single message into v, it
+// returns io.EOF once the stream ends and
+// io.ErrUnexpectedEOF when it ends inside
+// a message
+func (d *Decoder) Decode(v interface{}) error {
+	B, err := readWholeMessageInto(d.Buff[:0], d.R)
+
+	d.Buff = B
+
+	if err != nil {
+		return err
+	}
+
+	return d.Codec.Unmarshal(B, v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(b []byte, v interface{}) error {
+	return json.Unmarshal(b, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	B := bytes.NewBuffer(nil)
+
+	err := gob.NewEncoder(B).Encode(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return B.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(b []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+type binaryCodec struct{}
+
+func (binaryCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(encoding.BinaryMarshaler)
+
+	if !ok {
+		return nil, fmt.Errorf(
+			"proto: %T is not an encoding.BinaryMarshaler",
+			v,
+		)
+	}
+
+	return m.MarshalBinary()
+}
+
+func (binaryCodec) Unmarshal(b []byte, v interface{}) error {
+	u, ok := v.(encoding.BinaryUnmarshaler)
+
+	if !ok {
+		return fmt.Errorf(
+			"proto: %T is not an encoding.BinaryUnmarshaler",
+			v,
+		)
+	}
+
+	return u.UnmarshalBinary(b)
+}
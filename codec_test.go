@@ -0,0 +1,136 @@
+package proto_test
+
+import (
+	"bytes"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/johnmcconnell/proto/slim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+)
+
+type point struct {
+	X, Y int
+	Name string
+}
+
+func TestCodecs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	for _, c := range []proto.Codec{proto.JSON, proto.Gob} {
+		B := bytes.NewBuffer(nil)
+		W, R := proto.Wrap(qik.NewProtocol(), B, B)
+
+		E := proto.NewEncoder(W, c)
+		D := proto.NewDecoder(R, c)
+
+		Points := []point{{1, 2, "a"}, {3, 4, "b"}}
+
+		for _, p := range Points {
+			require.Nil(
+				E.Encode(p),
+				"the value was not encoded",
+			)
+		}
+
+		for _, p := range Points {
+			var Received point
+
+			require.Nil(
+				D.Decode(&Received),
+				"the value was not decoded",
+			)
+
+			assert.Equal(
+				p,
+				Received,
+				"values match",
+			)
+		}
+
+		var Received point
+
+		assert.Equal(
+			io.EOF,
+			D.Decode(&Received),
+			"the stream is over",
+		)
+	}
+}
+
+func TestTruncatedDecode(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+
+	proto.NewEncoder(slim.NewWriter(B), proto.JSON).Encode(point{1, 2, "a"})
+
+	// drop the TerminalByte
+	B.Truncate(B.Len() - 1)
+
+	var Received point
+
+	assert.Equal(
+		io.ErrUnexpectedEOF,
+		proto.NewDecoder(slim.NewReader(B), proto.JSON).Decode(&Received),
+		"the stream ended inside the message",
+	)
+}
+
+func TestBinaryCodec(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	B := bytes.NewBuffer(nil)
+	W, R := proto.Wrap(qik.NewProtocol(), B, B)
+
+	E := proto.NewEncoder(W, proto.Binary)
+	D := proto.NewDecoder(R, proto.Binary)
+
+	m := proto.NewMessage([]byte("hello"))
+	m.Header["method"] = "greet"
+
+	require.Nil(
+		E.Encode(m),
+		"the value was not encoded",
+	)
+
+	require.Nil(
+		E.Encode(proto.NewMessage([]byte("again"))),
+		"the value was not encoded",
+	)
+
+	Received := proto.Message{}
+
+	require.Nil(
+		D.Decode(&Received),
+		"the value was not decoded",
+	)
+
+	First := Received.Body
+
+	require.Nil(
+		D.Decode(&proto.Message{}),
+		"the value was not decoded",
+	)
+
+	assert.Equal(
+		"greet",
+		Received.Header["method"],
+		"headers match",
+	)
+
+	assert.Equal(
+		"hello",
+		string(First),
+		"the body was copied out of the reused buffer",
+	)
+
+	assert.NotNil(
+		E.Encode(point{}),
+		"points are not binary marshalers",
+	)
+}
@@ -0,0 +1,175 @@
+package proto
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+)
+
+var (
+	// aLongTimeAgo a deadline in the past that
+	// wakes up blocked reads and writes
+	aLongTimeAgo = time.Unix(1, 0)
+)
+
+// readDeadliner is a stream such as a net.Conn
+// or a Conn that can time out reads
+type readDeadliner interface {
+	SetReadDeadline(time.Time) error
+}
+
+// writeDeadliner is a stream such as a net.Conn
+// or a Conn that can time out writes
+type writeDeadliner interface {
+	SetWriteDeadline(time.Time) error
+}
+
+// ReadMessageContext reads a message like ReadMessage but
+// gives up once the context is done. If R has read
+// deadlines, such as a Conn, a blocked read is woken up,
+// otherwise the context is checked between reads. The
+// read deadline is cleared on return, and a message cut
+// short leaves the stream in the middle of a message
+func ReadMessageContext(ctx context.Context, R io.Reader) ([]byte, error) {
+	err := ctx.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if d, ok := R.(readDeadliner); ok {
+		defer watch(ctx, d.SetReadDeadline)()
+	}
+
+	r := contextReader{
+		ctx: ctx,
+		R:   R,
+	}
+
+	B, err := ReadMessage(&r)
+
+	return B, contextErr(ctx, err)
+}
+
+// WriteMessageContext writes a message like WriteMessage
+// but gives up once the context is done. If W has write
+// deadlines, such as a Conn, a blocked write is woken up
+func WriteMessageContext(ctx context.Context, W io.Writer, Bytes []byte) (int, error) {
+	err := ctx.Err()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if d, ok := W.(writeDeadliner); ok {
+		defer watch(ctx, d.SetWriteDeadline)()
+	}
+
+	n, err := WriteMessage(W, Bytes)
+
+	return n, contextErr(ctx, err)
+}
+
+// CopyMessagesContext copies messages like CopyMessages
+// but gives up once the context is done, using the read
+// deadlines of R and the write deadlines of W
+func CopyMessagesContext(ctx context.Context, W io.Writer, R io.Reader, B []byte, N int) (int, error) {
+	err := ctx.Err()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if d, ok := R.(readDeadliner); ok {
+		defer watch(ctx, d.SetReadDeadline)()
+	}
+
+	if d, ok := W.(writeDeadliner); ok {
+		defer watch(ctx, d.SetWriteDeadline)()
+	}
+
+	r := contextReader{
+		ctx: ctx,
+		R:   R,
+	}
+
+	n, err := CopyMessages(W, &r, B, N)
+
+	return n, contextErr(ctx, err)
+}
+
+// watch sets the context's deadline and moves it into
+// the past once the context is done, the returned
+// func stops watching and clears the deadline
+func watch(ctx context.Context, set func(time.Time) error) func() {
+	if d, ok := ctx.Deadline(); ok {
+		set(d)
+	}
+
+	// the context is never done
+	if ctx.Done() == nil {
+		return func() {
+			set(time.Time{})
+		}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		select {
+		case <-ctx.Done():
+			set(aLongTimeAgo)
+
+		case <-stop:
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+
+		set(time.Time{})
+	}
+}
+
+// contextErr hands back the context's error in
+// place of an error the context caused
+func contextErr(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// the deadline of the stream can fire
+	// just before the context's own timer
+	if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return context.DeadlineExceeded
+		}
+	}
+
+	return err
+}
+
+// contextReader checks the context before every read
+type contextReader struct {
+	ctx context.Context
+	R   io.Reader
+}
+
+func (r *contextReader) Read(b []byte) (int, error) {
+	err := r.ctx.Err()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return r.R.Read(b)
+}
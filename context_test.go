@@ -0,0 +1,158 @@
+package proto_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func pipeConns() (net.Conn, net.Conn) {
+	a, b := net.Pipe()
+
+	return proto.WrapConn(qik.NewProtocol(), a), proto.WrapConn(qik.NewProtocol(), b)
+}
+
+func TestReadMessageContext(t *testing.T) {
+	assert := assert.New(t)
+
+	A, B := pipeConns()
+	defer A.Close()
+	defer B.Close()
+
+	go proto.WriteMessage(A, []byte("hello"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	Received, err := proto.ReadMessageContext(ctx, B)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"hello",
+		string(Received),
+		"bytes match",
+	)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = proto.ReadMessageContext(ctx, B)
+
+	assert.Equal(
+		context.DeadlineExceeded,
+		err,
+		"nothing was sent before the deadline",
+	)
+
+	ctx, cancel = context.WithCancel(context.Background())
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err = proto.ReadMessageContext(ctx, B)
+
+	assert.Equal(
+		context.Canceled,
+		err,
+		"the blocked read was woken up",
+	)
+
+	go proto.WriteMessage(A, []byte("again"))
+
+	Received, err = proto.ReadMessageContext(context.Background(), B)
+
+	assert.Nil(
+		err,
+		"the deadline was cleared",
+	)
+
+	assert.Equal(
+		"again",
+		string(Received),
+		"bytes match",
+	)
+}
+
+func TestWriteMessageContext(t *testing.T) {
+	assert := assert.New(t)
+
+	A, B := pipeConns()
+	defer A.Close()
+	defer B.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// nothing reads the other end of the pipe
+	_, err := proto.WriteMessageContext(ctx, A, []byte("hello"))
+
+	assert.Equal(
+		context.DeadlineExceeded,
+		err,
+		"the blocked write was woken up",
+	)
+}
+
+func TestCopyMessagesContext(t *testing.T) {
+	assert := assert.New(t)
+
+	A, B := pipeConns()
+	defer A.Close()
+	defer B.Close()
+
+	go proto.WriteMessage(A, []byte("relay"))
+
+	Out := bytes.NewBuffer(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	n, err := proto.CopyMessagesContext(ctx, qik.NewWriter(Out), B, make([]byte, 16), -1)
+
+	assert.Equal(
+		context.DeadlineExceeded,
+		err,
+		"copying forever stops at the deadline",
+	)
+
+	assert.Equal(
+		0,
+		n,
+		"no bytes were pending",
+	)
+
+	Received, err := proto.ReadMessage(qik.NewReader(Out))
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"relay",
+		string(Received),
+		"the message was copied",
+	)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	_, err = proto.ReadMessageContext(ctx, bytes.NewReader(nil))
+
+	assert.Equal(
+		context.Canceled,
+		err,
+		"a done context fails without reading",
+	)
+}
@@ -0,0 +1,210 @@
+package crc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/johnmcconnell/proto"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// TrailerSize the count of bytes added to
+	// the end of every message
+	TrailerSize = 4
+	// BufferSize the count of bytes the reader
+	// reads off of the inner reader at once
+	BufferSize = 512
+)
+
+var (
+	// Table the Castagnoli (CRC32C) table
+	Table = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// ChecksumError is returned at the end of a message
+// when its trailer does not match its bytes
+type ChecksumError struct {
+	Expected uint32
+	Actual   uint32
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf(
+		"crc: checksum mismatch, trailer is [%08x] but message is [%08x]",
+		e.Expected,
+		e.Actual,
+	)
+}
+
+// Protocol adds a CRC32C trailer to every
+// message of the inner protocol
+type Protocol struct {
+	P proto.Protocol
+}
+
+// NewReader ...
+func (p *Protocol) NewReader(R io.Reader) io.Reader {
+	return NewReader(p.P.NewReader(R))
+}
+
+// NewWriter ...
+func (p *Protocol) NewWriter(W io.Writer) io.Writer {
+	return NewWriter(p.P.NewWriter(W))
+}
+
+// NewProtocol ...
+func NewProtocol(P proto.Protocol) *Protocol {
+	p := Protocol{
+		P: P,
+	}
+
+	return &p
+}
+
+// Reader checks the trailer of every message
+// read off of an inner message reader, it holds
+// back the last TrailerSize bytes until proto.ErrEOM
+type Reader struct {
+	R       io.Reader
+	Buff    []byte
+	Pending []byte
+	Hash    hash.Hash32
+	EOM     bool
+}
+
+// Writer adds the trailer to every message
+// written to an inner message writer
+type Writer struct {
+	W    io.Writer
+	Buff []byte
+	Hash hash.Hash32
+}
+
+// NewReader creates a new Reader over
+// an inner message reader
+func NewReader(R io.Reader) *Reader {
+	r := Reader{
+		R:    R,
+		Buff: make([]byte, TrailerSize+BufferSize),
+		Hash: crc32.New(Table),
+	}
+
+	return &r
+}
+
+// NewWriter creates a new Writer over
+// an inner message writer
+func NewWriter(W io.Writer) *Writer {
+	w := Writer{
+		W:    W,
+		Buff: make([]byte, TrailerSize),
+		Hash: crc32.New(Table),
+	}
+
+	return &w
+}
+
+// Read reads the message bytes into b, at the end
+// of the message it returns proto.ErrEOM or a
+// *ChecksumError if the trailer does not match
+func (r *Reader) Read(b []byte) (int, error) {
+	for {
+		if len(r.Pending) > TrailerSize {
+			L := len(r.Pending) - TrailerSize
+
+			if L > len(b) {
+				L = len(b)
+			}
+
+			n := copy(b, r.Pending[:L])
+
+			r.Hash.Write(b[:n])
+			r.Pending = r.Pending[n:]
+
+			return n, nil
+		}
+
+		if r.EOM {
+			return 0, r.check()
+		}
+
+		// move the held back bytes to the front
+		// and read in behind them
+		L := copy(r.Buff, r.Pending)
+
+		n, err := r.R.Read(r.Buff[L:])
+
+		r.Pending = r.Buff[:L+n]
+
+		if err == proto.ErrEOM {
+			r.EOM = true
+
+			continue
+		}
+
+		if err == io.EOF && len(r.Pending) > 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// check compares the trailer and resets
+// the reader for the next message
+func (r *Reader) check() error {
+	Pending := r.Pending
+	Actual := r.Hash.Sum32()
+
+	r.Pending = nil
+	r.EOM = false
+	r.Hash.Reset()
+
+	if len(Pending) != TrailerSize {
+		return fmt.Errorf(
+			"crc: message is missing its %v byte trailer",
+			TrailerSize,
+		)
+	}
+
+	Expected := binary.BigEndian.Uint32(Pending)
+
+	if Expected != Actual {
+		return &ChecksumError{
+			Expected: Expected,
+			Actual:   Actual,
+		}
+	}
+
+	return proto.ErrEOM
+}
+
+// Write writes the bytes to the inner writer, writing
+// the nil buffer or the empty buffer writes the
+// trailer and ends the message
+func (w *Writer) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		binary.BigEndian.PutUint32(w.Buff, w.Hash.Sum32())
+		w.Hash.Reset()
+
+		_, err := w.W.Write(w.Buff)
+
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = w.W.Write(nil)
+
+		return 0, err
+	}
+
+	n, err := w.W.Write(b)
+
+	w.Hash.Write(b[:n])
+
+	return n, err
+}
@@ -0,0 +1,203 @@
+package crc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/johnmcconnell/proto/slim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+)
+
+func randomBytes(S int) ([]byte, error) {
+	BS := make([]byte, S)
+
+	_, err := rand.Read(BS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return BS, err
+}
+
+func TestRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	for _, P := range []proto.Protocol{qik.NewProtocol(), slim.NewProtocol()} {
+		p := NewProtocol(P)
+
+		B := bytes.NewBuffer(nil)
+		W, R := proto.Wrap(p, B, B)
+
+		Messages := [][]byte{}
+
+		for _, L := range []int{0, 1, 3, 4, 5, 1000, 100 * 1000} {
+			Message, err := randomBytes(L)
+
+			require.Nil(
+				err,
+				"could not create random bytes",
+			)
+
+			_, err = proto.WriteMessage(W, Message)
+
+			require.Nil(
+				err,
+				"bytes not written",
+			)
+
+			Messages = append(Messages, Message)
+		}
+
+		for _, Sent := range Messages {
+			Received, err := proto.ReadMessage(R)
+
+			assert.Nil(
+				err,
+				"bytes not read",
+			)
+
+			assert.Equal(
+				len(Sent),
+				len(Received),
+				"lengths match",
+			)
+
+			assert.True(
+				bytes.Equal(Sent, Received),
+				"bytes match",
+			)
+		}
+
+		_, err := R.Read(make([]byte, 16))
+
+		assert.Equal(
+			io.EOF,
+			err,
+			"Using io.EOF to designate end of file",
+		)
+	}
+}
+
+func TestWriteEmptyMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+	W, R := proto.Wrap(NewProtocol(qik.NewProtocol()), B, B)
+
+	// a second end of message would
+	// write a second checked message
+	proto.WriteMessage(W, nil)
+
+	Received, err := proto.ReadMessage(R)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		0,
+		len(Received),
+		"the message is empty",
+	)
+
+	_, err = R.Read(make([]byte, 16))
+
+	assert.Equal(
+		io.EOF,
+		err,
+		"there is exactly one message",
+	)
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+	W := NewWriter(qik.NewWriter(B))
+
+	proto.WriteMessage(W, []byte("hello world"))
+	proto.WriteMessage(W, []byte("second"))
+
+	// flip a bit of the first payload
+	B.Bytes()[4] ^= 0x01
+
+	R := NewReader(qik.NewReader(B))
+
+	_, err := proto.ReadMessage(R)
+
+	assert.IsType(
+		&ChecksumError{},
+		err,
+		"the corrupted message fails its check",
+	)
+
+	Received, err := proto.ReadMessage(R)
+
+	assert.Nil(
+		err,
+		"the next message is read",
+	)
+
+	assert.Equal(
+		"second",
+		string(Received),
+		"bytes match",
+	)
+}
+
+func TestMissingTrailer(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+	proto.WriteMessage(qik.NewWriter(B), []byte{1, 2})
+
+	R := NewReader(qik.NewReader(B))
+
+	_, err := proto.ReadMessage(R)
+
+	assert.NotNil(
+		err,
+		"a message shorter than the trailer is an error",
+	)
+}
+
+func TestCopyMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	p := NewProtocol(qik.NewProtocol())
+
+	Encoded := bytes.NewBuffer(nil)
+	W, _ := proto.Wrap(p, Encoded, nil)
+
+	proto.WriteMessage(W, []byte("relay me"))
+
+	Again := bytes.NewBuffer(nil)
+	WAgain, _ := proto.Wrap(p, Again, nil)
+
+	_, err := proto.CopyMessages(WAgain, p.NewReader(Encoded), make([]byte, 3), 1)
+
+	assert.Nil(
+		err,
+		"there is no error",
+	)
+
+	Received, err := proto.ReadMessage(p.NewReader(Again))
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"relay me",
+		string(Received),
+		"bytes match",
+	)
+}
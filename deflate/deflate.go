@@ -0,0 +1,402 @@
+package deflate
+
+import (
+	"compress/flate"
+	"fmt"
+	"github.com/johnmcconnell/proto"
+	"io"
+)
+
+const (
+	// BufferSize the count of bytes the reader
+	// reads off of the inner reader at once
+	BufferSize = 512
+	// DefaultThreshold messages smaller than this
+	// many bytes are sent uncompressed
+	DefaultThreshold = 256
+	// FlagRaw the first byte of an uncompressed message
+	FlagRaw = 0
+	// FlagFlate the first byte of a compressed message
+	FlagFlate = 1
+)
+
+// Protocol compresses every message of the inner
+// protocol with compress/flate. Passing messages
+// through a relay with the inner protocol keeps
+// them compressed
+type Protocol struct {
+	P         proto.Protocol
+	Level     int
+	Threshold int
+}
+
+// NewReader ...
+func (p *Protocol) NewReader(R io.Reader) io.Reader {
+	return NewReader(p.P.NewReader(R))
+}
+
+// NewWriter ...
+func (p *Protocol) NewWriter(W io.Writer) io.Writer {
+	w := NewWriter(p.P.NewWriter(W))
+	w.Level = p.Level
+	w.Threshold = p.Threshold
+
+	return w
+}
+
+// NewProtocol ...
+func NewProtocol(P proto.Protocol) *Protocol {
+	p := Protocol{
+		P:         P,
+		Level:     flate.DefaultCompression,
+		Threshold: DefaultThreshold,
+	}
+
+	return &p
+}
+
+// Reader decompresses every message read
+// off of an inner message reader
+type Reader struct {
+	R          io.Reader
+	Flag       []byte
+	Started    bool
+	Compressed bool
+	EOM        bool
+	Message    messageReader
+	Flate      io.ReadCloser
+}
+
+// Writer compresses every message written to
+// an inner message writer once it reaches
+// Threshold bytes
+type Writer struct {
+	W          io.Writer
+	Level      int
+	Threshold  int
+	Flag       []byte
+	Buff       []byte
+	Compressed bool
+	Flate      *flate.Writer
+}
+
+// NewReader creates a new Reader over
+// an inner message reader
+func NewReader(R io.Reader) *Reader {
+	r := Reader{
+		R:    R,
+		Flag: make([]byte, 1),
+		Message: messageReader{
+			R:    R,
+			Buff: make([]byte, BufferSize),
+		},
+	}
+
+	return &r
+}
+
+// NewWriter creates a new Writer over
+// an inner message writer
+func NewWriter(W io.Writer) *Writer {
+	w := Writer{
+		W:         W,
+		Level:     flate.DefaultCompression,
+		Threshold: DefaultThreshold,
+		Flag:      make([]byte, 1),
+	}
+
+	return &w
+}
+
+// Read reads the decompressed message bytes into b,
+// it returns proto.ErrEOM at the end of the message
+func (r *Reader) Read(b []byte) (int, error) {
+	if r.EOM {
+		r.EOM = false
+
+		return 0, proto.ErrEOM
+	}
+
+	if !r.Started {
+		err := r.start()
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if !r.Compressed {
+		n, err := r.R.Read(b)
+
+		if err == proto.ErrEOM {
+			r.Started = false
+		}
+
+		return n, err
+	}
+
+	n, err := r.Flate.Read(b)
+
+	if err == io.EOF {
+		err = r.Message.drain()
+
+		if err != nil {
+			return n, err
+		}
+
+		r.Started = false
+
+		if n > 0 {
+			r.EOM = true
+
+			return n, nil
+		}
+
+		return 0, proto.ErrEOM
+	}
+
+	return n, err
+}
+
+// start reads the flag byte of a new message
+func (r *Reader) start() error {
+	for {
+		n, err := r.R.Read(r.Flag)
+
+		if err != nil {
+			return err
+		}
+
+		if n == 1 {
+			break
+		}
+	}
+
+	switch r.Flag[0] {
+	case FlagRaw:
+		r.Compressed = false
+
+	case FlagFlate:
+		r.Compressed = true
+		r.Message.reset()
+
+		if r.Flate == nil {
+			r.Flate = flate.NewReader(&r.Message)
+		} else {
+			r.Flate.(flate.Resetter).Reset(&r.Message, nil)
+		}
+
+	default:
+		return fmt.Errorf(
+			"deflate: unknown message flag [%v]",
+			r.Flag[0],
+		)
+	}
+
+	r.Started = true
+
+	return nil
+}
+
+// Write writes the bytes to the inner writer, writing
+// the nil buffer or the empty buffer ends the message
+func (w *Writer) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, w.end()
+	}
+
+	if w.Compressed {
+		return w.Flate.Write(b)
+	}
+
+	// the first byte is saved for the flag so
+	// a raw message goes out in a single write
+	if len(w.Buff) == 0 {
+		w.Buff = append(w.Buff, FlagRaw)
+	}
+
+	w.Buff = append(w.Buff, b...)
+
+	if len(w.Buff)-1 < w.Threshold {
+		return len(b), nil
+	}
+
+	err := w.start()
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = w.Flate.Write(w.Buff[1:])
+
+	w.Buff = w.Buff[:0]
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// start starts a compressed message
+func (w *Writer) start() error {
+	w.Flag[0] = FlagFlate
+
+	_, err := w.W.Write(w.Flag)
+
+	if err != nil {
+		return err
+	}
+
+	// flate may write the empty buffer which
+	// would end the inner message early
+	W := nonEmptyWriter{
+		W: w.W,
+	}
+
+	if w.Flate == nil {
+		w.Flate, err = flate.NewWriter(W, w.Level)
+
+		if err != nil {
+			return err
+		}
+	} else {
+		w.Flate.Reset(W)
+	}
+
+	w.Compressed = true
+
+	return nil
+}
+
+// end finishes the message and ends
+// the inner message
+func (w *Writer) end() error {
+	if w.Compressed {
+		w.Compressed = false
+
+		err := w.Flate.Close()
+
+		if err != nil {
+			return err
+		}
+	} else {
+		if len(w.Buff) == 0 {
+			w.Buff = append(w.Buff, FlagRaw)
+		}
+
+		_, err := w.W.Write(w.Buff)
+
+		w.Buff = w.Buff[:0]
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := w.W.Write(nil)
+
+	return err
+}
+
+// messageReader reads a single inner message
+// and returns io.EOF at its end, so it can be
+// handed to the flate reader
+type messageReader struct {
+	R       io.Reader
+	Buff    []byte
+	Pending []byte
+	EOM     bool
+}
+
+func (m *messageReader) reset() {
+	m.Pending = nil
+	m.EOM = false
+}
+
+func (m *messageReader) fill() error {
+	for len(m.Pending) == 0 {
+		if m.EOM {
+			return io.EOF
+		}
+
+		n, err := m.R.Read(m.Buff)
+
+		m.Pending = m.Buff[:n]
+
+		if err == proto.ErrEOM {
+			m.EOM = true
+
+			continue
+		}
+
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Read ...
+func (m *messageReader) Read(b []byte) (int, error) {
+	err := m.fill()
+
+	if err != nil {
+		return 0, err
+	}
+
+	n := copy(b, m.Pending)
+	m.Pending = m.Pending[n:]
+
+	return n, nil
+}
+
+// ReadByte so flate does not add its own buffer
+func (m *messageReader) ReadByte() (byte, error) {
+	err := m.fill()
+
+	if err != nil {
+		return 0, err
+	}
+
+	c := m.Pending[0]
+	m.Pending = m.Pending[1:]
+
+	return c, nil
+}
+
+// drain reads up to the end of the inner message,
+// there should be nothing past the flate stream
+func (m *messageReader) drain() error {
+	err := m.fill()
+
+	if err == io.EOF {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf(
+		"deflate: bytes remaining after the compressed message",
+	)
+}
+
+// nonEmptyWriter drops empty writes
+type nonEmptyWriter struct {
+	W io.Writer
+}
+
+func (w nonEmptyWriter) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	return w.W.Write(b)
+}
@@ -0,0 +1,166 @@
+package deflate
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/johnmcconnell/proto/slim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+)
+
+func randomBytes(S int) ([]byte, error) {
+	BS := make([]byte, S)
+
+	_, err := rand.Read(BS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return BS, err
+}
+
+func TestRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	Random, err := randomBytes(100 * 1000)
+
+	require.Nil(
+		err,
+		"could not create random bytes",
+	)
+
+	Messages := [][]byte{
+		{},
+		[]byte("short"),
+		bytes.Repeat([]byte(`{"key": "value"}`), 10*1000),
+		Random,
+	}
+
+	for _, P := range []proto.Protocol{qik.NewProtocol(), slim.NewProtocol()} {
+		B := bytes.NewBuffer(nil)
+		W, R := proto.Wrap(NewProtocol(P), B, B)
+
+		for _, Message := range Messages {
+			_, err := proto.WriteMessage(W, Message)
+
+			require.Nil(
+				err,
+				"bytes not written",
+			)
+		}
+
+		for _, Sent := range Messages {
+			Received, err := proto.ReadMessage(R)
+
+			assert.Nil(
+				err,
+				"bytes not read",
+			)
+
+			assert.True(
+				bytes.Equal(Sent, Received),
+				"bytes match",
+			)
+		}
+
+		_, err := R.Read(make([]byte, 16))
+
+		assert.Equal(
+			io.EOF,
+			err,
+			"Using io.EOF to designate end of file",
+		)
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	assert := assert.New(t)
+
+	Message := bytes.Repeat([]byte("a"), 1000)
+
+	B := bytes.NewBuffer(nil)
+	W := NewWriter(qik.NewWriter(B))
+
+	proto.WriteMessage(W, Message[:10])
+
+	assert.Equal(
+		[]byte{0, 11, FlagRaw},
+		B.Bytes()[:3],
+		"a short message is sent raw",
+	)
+
+	B.Reset()
+
+	proto.WriteMessage(W, Message)
+
+	assert.Equal(
+		byte(FlagFlate),
+		B.Bytes()[2],
+		"a long message is compressed",
+	)
+
+	assert.True(
+		B.Len() < 100,
+		"the message is compressed",
+	)
+}
+
+func TestCopyMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	p := NewProtocol(qik.NewProtocol())
+	Message := bytes.Repeat([]byte("relay me "), 1000)
+
+	Encoded := bytes.NewBuffer(nil)
+	W, _ := proto.Wrap(p, Encoded, nil)
+
+	proto.WriteMessage(W, Message)
+	proto.WriteMessage(W, Message)
+
+	// re-compress the first message and pass
+	// the second through still compressed
+	Again := bytes.NewBuffer(nil)
+	WAgain, _ := proto.Wrap(p, Again, nil)
+
+	R := p.NewReader(Encoded)
+	B := make([]byte, 512)
+
+	_, err := proto.CopyMessages(WAgain, R, B, 1)
+
+	assert.Nil(
+		err,
+		"there is no error",
+	)
+
+	Inner, _ := proto.Wrap(qik.NewProtocol(), Again, nil)
+
+	_, err = proto.CopyMessages(Inner, qik.NewReader(Encoded), B, 1)
+
+	assert.Nil(
+		err,
+		"there is no error",
+	)
+
+	R = p.NewReader(Again)
+
+	for i := 0; i < 2; i++ {
+		Received, err := proto.ReadMessage(R)
+
+		assert.Nil(
+			err,
+			"bytes not read",
+		)
+
+		assert.Equal(
+			Message,
+			Received,
+			"bytes match",
+		)
+	}
+}
@@ -0,0 +1,264 @@
+package delim
+
+import (
+	"bytes"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/internal/flat"
+	"io"
+)
+
+const (
+	// BufferSize the size of the read buffer
+	BufferSize = 512
+	// DefaultMaxLine the longest line read
+	// when the protocol sets no Max
+	DefaultMaxLine = 64 * 1024
+)
+
+var (
+	// LF ends lines with "\n"
+	LF = []byte("\n")
+	// CRLF ends lines with "\r\n"
+	CRLF = []byte("\r\n")
+)
+
+// Protocol ends every message with Delim, such as
+// a newline. Nothing is escaped, so a message must
+// not hold the delimiter. Lines past Max bytes, or
+// DefaultMaxLine when zero, are skipped
+type Protocol struct {
+	Delim []byte
+	Max   int
+}
+
+// NewReader ...
+func (p *Protocol) NewReader(R io.Reader) io.Reader {
+	r := NewReader(R, p.Delim)
+
+	if p.Max > 0 {
+		r.Max = p.Max
+	}
+
+	return r
+}
+
+// NewWriter ...
+func (p *Protocol) NewWriter(W io.Writer) io.Writer {
+	return NewWriter(W, p.Delim)
+}
+
+// NewProtocol creates a protocol for the
+// delimiter, it panics if it is empty
+func NewProtocol(Delim []byte, Max int) *Protocol {
+	if len(Delim) == 0 {
+		panic("delim: the delimiter is empty")
+	}
+
+	p := Protocol{
+		Delim: Delim,
+		Max:   Max,
+	}
+
+	return &p
+}
+
+func init() {
+	proto.Register("line", func() proto.Protocol {
+		return NewProtocol(LF, 0)
+	})
+
+	proto.Register("crlf", func() proto.Protocol {
+		return NewProtocol(CRLF, 0)
+	})
+}
+
+// Reader read messages using this Reader. The
+// bytes of a delimiter that may be cut short
+// stay in Pending until more are read. Lines
+// past Max bytes are skipped and return
+// proto.ErrMessageTooLarge
+type Reader struct {
+	R       io.Reader
+	Delim   []byte
+	Buff    []byte
+	Pending []byte
+	Err     error
+	Skip    bool
+	Max     int
+	Size    int
+}
+
+// Writer encode messages using this Writer
+type Writer struct {
+	W     io.Writer
+	Delim []byte
+
+	flat flat.Buffer
+}
+
+// NewReader creates a new Reader that will
+// decode lines ending in Delim from R
+func NewReader(R io.Reader, Delim []byte) *Reader {
+	S := BufferSize
+
+	if S < 2*len(Delim) {
+		S = 2 * len(Delim)
+	}
+
+	r := Reader{
+		R:     R,
+		Delim: Delim,
+		Buff:  make([]byte, S),
+		Max:   DefaultMaxLine,
+	}
+
+	r.Pending = r.Buff[:0]
+
+	return &r
+}
+
+// NewWriter creates a new Writer that will
+// encode lines ending in Delim to W
+func NewWriter(W io.Writer, Delim []byte) *Writer {
+	w := Writer{
+		W:     W,
+		Delim: Delim,
+	}
+
+	w.flat.Encode = w.message
+
+	return &w
+}
+
+// Read reads the line into b, it returns
+// proto.ErrEOM at the delimiter. A last line
+// without a delimiter ends with the stream
+func (r *Reader) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	for {
+		i := bytes.Index(r.Pending, r.Delim)
+
+		if i == 0 {
+			r.Pending = r.Pending[len(r.Delim):]
+			r.Size = 0
+
+			if r.Skip {
+				r.Skip = false
+
+				return 0, proto.ErrMessageTooLarge
+			}
+
+			return 0, proto.ErrEOM
+		}
+
+		// the end may be the start of a delimiter
+		L := len(r.Pending) - len(r.Delim) + 1
+
+		if i > 0 {
+			L = i
+		}
+
+		if r.Err == io.EOF && i < 0 {
+			L = len(r.Pending)
+		}
+
+		if L > 0 {
+			n, ok := r.take(b, L)
+
+			if ok {
+				return n, nil
+			}
+
+			continue
+		}
+
+		if r.Err != nil {
+			return 0, r.readErr()
+		}
+
+		r.fill()
+	}
+}
+
+// SetMaxMessageSize ...
+func (r *Reader) SetMaxMessageSize(Max int) {
+	r.Max = Max
+}
+
+// readErr hands back the read error, only io.EOF
+// is kept so a read past a deadline can be retried
+func (r *Reader) readErr() error {
+	err := r.Err
+
+	if err != io.EOF {
+		r.Err = nil
+	}
+
+	return err
+}
+
+// take moves up to L pending bytes into b, it
+// returns false while the line is skipped
+func (r *Reader) take(b []byte, L int) (int, bool) {
+	if r.Max > 0 && r.Size+L > r.Max {
+		r.Skip = true
+	}
+
+	if r.Skip {
+		r.Pending = r.Pending[L:]
+
+		return 0, false
+	}
+
+	n := copy(b, r.Pending[:L])
+
+	r.Pending = r.Pending[n:]
+	r.Size += n
+
+	return n, true
+}
+
+// fill moves the pending bytes to the front
+// of Buff and reads more in after them
+func (r *Reader) fill() {
+	P := copy(r.Buff, r.Pending)
+
+	n, err := r.R.Read(r.Buff[P:])
+
+	r.Pending = r.Buff[:P+n]
+	r.Err = err
+}
+
+// Write writes the bytes of the line as they
+// are, writing the empty buffer ends the line
+func (w *Writer) Write(b []byte) (int, error) {
+	if len(b) > 0 {
+		return w.W.Write(b)
+	}
+
+	_, err := w.W.Write(w.Delim)
+
+	return 0, err
+}
+
+// WriteMessage writes the whole message
+// in a single write
+func (w *Writer) WriteMessage(b []byte) (int, error) {
+	return w.flat.WriteMessages(w.W, b)
+}
+
+// WriteMessages writes every message
+// in a single write
+func (w *Writer) WriteMessages(msgs ...[]byte) (int, error) {
+	return w.flat.WriteMessages(w.W, msgs...)
+}
+
+// message appends the line and its delimiter
+func (w *Writer) message(Flat []byte, m []byte) ([]byte, error) {
+	Flat = append(Flat, m...)
+
+	return append(Flat, w.Delim...), nil
+}
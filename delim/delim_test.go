@@ -0,0 +1,198 @@
+package delim
+
+import (
+	"bytes"
+	"github.com/johnmcconnell/proto"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// flaky fails its first read like a
+// read past a deadline
+type flaky struct {
+	R      io.Reader
+	Failed bool
+}
+
+func (f *flaky) Read(b []byte) (int, error) {
+	if !f.Failed {
+		f.Failed = true
+
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	return f.R.Read(b)
+}
+
+func TestEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+	W := NewWriter(B, CRLF)
+
+	W.Write([]byte("HELO "))
+	W.Write([]byte("example.com"))
+	W.Write(nil)
+
+	proto.WriteMessages(W, []byte("NOOP"), nil, []byte("QUIT"))
+
+	assert.Equal(
+		"HELO example.com\r\nNOOP\r\n\r\nQUIT\r\n",
+		B.String(),
+		"lines end in the delimiter",
+	)
+}
+
+func TestDecoding(t *testing.T) {
+	assert := assert.New(t)
+
+	Cases := []struct {
+		Delim []byte
+		In    string
+		E     []string
+	}{
+		{LF, "one\ntwo\n\nthree\n", []string{"one", "two", "", "three"}},
+		{CRLF, "one\r\ntwo\rtoo\r\n\r\n", []string{"one", "two\rtoo", ""}},
+		{[]byte("abab"), "xabaabab-abababab", []string{"xaba", "-", ""}},
+		{LF, "one\nlast line", []string{"one", "last line"}},
+	}
+
+	for _, c := range Cases {
+		// one byte at a time splits every delimiter
+		for _, R := range []io.Reader{strings.NewReader(c.In), iotest.OneByteReader(strings.NewReader(c.In))} {
+			D := NewReader(R, c.Delim)
+
+			for _, m := range c.E {
+				Received, err := proto.ReadMessage(D)
+
+				assert.Nil(
+					err,
+					"bytes not read",
+				)
+
+				assert.Equal(
+					m,
+					string(Received),
+					"bytes match",
+				)
+			}
+
+			_, err := D.Read(make([]byte, 16))
+
+			assert.Equal(
+				io.EOF,
+				err,
+				"the stream is over",
+			)
+		}
+	}
+}
+
+func TestSmallReads(t *testing.T) {
+	assert := assert.New(t)
+
+	D := NewReader(strings.NewReader("hello\r\n"), CRLF)
+
+	b := make([]byte, 2)
+	Received := []byte{}
+
+	for {
+		n, err := D.Read(b)
+
+		Received = append(Received, b[:n]...)
+
+		if err != nil {
+			assert.Equal(
+				proto.ErrEOM,
+				err,
+				"the line ended",
+			)
+
+			break
+		}
+	}
+
+	assert.Equal(
+		"hello",
+		string(Received),
+		"bytes match",
+	)
+}
+
+func TestMaxLine(t *testing.T) {
+	assert := assert.New(t)
+
+	Long := strings.Repeat("x", 1000)
+
+	D := NewProtocol(LF, 100).NewReader(strings.NewReader("short\n" + Long + "\nagain\n"))
+
+	for _, E := range []error{nil, proto.ErrMessageTooLarge, nil} {
+		_, err := proto.ReadMessage(D)
+
+		assert.Equal(
+			E,
+			err,
+			"lines past the max are skipped",
+		)
+	}
+
+	assert.Equal(
+		DefaultMaxLine,
+		NewReader(nil, LF).Max,
+		"lines have a max by default",
+	)
+}
+
+func TestRegistered(t *testing.T) {
+	assert := assert.New(t)
+
+	for Name, Delim := range map[string][]byte{"line": LF, "crlf": CRLF} {
+		p, ok := proto.Lookup(Name)
+
+		assert.True(
+			ok,
+			"delim registers itself",
+		)
+
+		assert.Equal(
+			Delim,
+			p.(*Protocol).Delim,
+			"the delimiter matches the name",
+		)
+	}
+}
+
+func TestReadAfterTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+
+	proto.WriteMessage(NewWriter(B, CRLF), []byte("after"))
+
+	R := NewReader(&flaky{R: B}, CRLF)
+
+	_, err := proto.ReadMessage(R)
+
+	assert.Equal(
+		os.ErrDeadlineExceeded,
+		err,
+		"the read timed out",
+	)
+
+	Received, err := proto.ReadMessage(R)
+
+	assert.Nil(
+		err,
+		"the reader recovers from a timeout",
+	)
+
+	assert.Equal(
+		"after",
+		string(Received),
+		"bytes match",
+	)
+}
@@ -0,0 +1,176 @@
+package proto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+var (
+	// ErrBadEnvelope a message is not
+	// a well formed envelope
+	ErrBadEnvelope = fmt.Errorf(
+		"malformed message envelope",
+	)
+)
+
+// Message is an envelope of string headers, such as
+// a content type, trace ID or method, around a body.
+// It travels as a single message of any protocol so
+// middleware can read the headers without knowing
+// the format of the body
+type Message struct {
+	Header map[string]string
+	Body   []byte
+}
+
+// NewMessage ...
+func NewMessage(Body []byte) *Message {
+	m := Message{
+		Header: make(map[string]string),
+		Body:   Body,
+	}
+
+	return &m
+}
+
+// MarshalBinary encodes the envelope as the uvarint
+// count of headers, each key and value as a uvarint
+// length and its bytes in key order, then the body
+func (m *Message) MarshalBinary() ([]byte, error) {
+	return m.appendBinary(nil), nil
+}
+
+// UnmarshalBinary decodes the envelope
+func (m *Message) UnmarshalBinary(b []byte) error {
+	err := m.decode(b)
+
+	if err != nil {
+		return err
+	}
+
+	m.Body = append([]byte(nil), m.Body...)
+
+	return nil
+}
+
+// decode decodes the envelope like UnmarshalBinary
+// but the body refers to b rather than a copy
+func (m *Message) decode(b []byte) error {
+	N, n := binary.Uvarint(b)
+
+	// every header takes at least two bytes
+	if n <= 0 || N > uint64(len(b)-n)/2 {
+		return ErrBadEnvelope
+	}
+
+	b = b[n:]
+
+	Header := make(map[string]string, int(N))
+
+	for i := uint64(0); i < N; i++ {
+		var Key, Value []byte
+
+		Key, b = uvarintBytes(b)
+
+		if Key == nil {
+			return ErrBadEnvelope
+		}
+
+		Value, b = uvarintBytes(b)
+
+		if Value == nil {
+			return ErrBadEnvelope
+		}
+
+		Header[string(Key)] = string(Value)
+	}
+
+	m.Header = Header
+	m.Body = b
+
+	return nil
+}
+
+// appendBinary appends the encoding to B
+func (m *Message) appendBinary(B []byte) []byte {
+	Keys := make([]string, 0, len(m.Header))
+
+	for k := range m.Header {
+		Keys = append(Keys, k)
+	}
+
+	// the same headers always encode the same way
+	sort.Strings(Keys)
+
+	B = appendUvarint(B, uint64(len(Keys)))
+
+	for _, k := range Keys {
+		v := m.Header[k]
+
+		B = appendUvarint(B, uint64(len(k)))
+		B = append(B, k...)
+		B = appendUvarint(B, uint64(len(v)))
+		B = append(B, v...)
+	}
+
+	return append(B, m.Body...)
+}
+
+// appendUvarint appends x as a uvarint
+func appendUvarint(B []byte, x uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+
+	n := binary.PutUvarint(b[:], x)
+
+	return append(B, b[:n]...)
+}
+
+// uvarintBytes splits off a uvarint length and that
+// many bytes, it returns nil if b is too short
+func uvarintBytes(b []byte) ([]byte, []byte) {
+	L, n := binary.Uvarint(b)
+
+	if n <= 0 || L > uint64(len(b)-n) {
+		return nil, b
+	}
+
+	b = b[n:]
+
+	return b[:L:L], b[L:]
+}
+
+// WriteEnvelope writes the envelope as a single
+// message, returns the count of bytes written
+func WriteEnvelope(W io.Writer, m *Message) (int, error) {
+	b := GetBuffer()
+	defer b.Release()
+
+	b.B = m.appendBinary(b.B)
+
+	return WriteMessage(W, b.B)
+}
+
+// ReadEnvelope reads a message and decodes its
+// envelope. It returns io.EOF once the stream
+// ends, io.ErrUnexpectedEOF when it ends inside
+// a message and ErrBadEnvelope for a message
+// that is not an envelope
+func ReadEnvelope(R io.Reader) (*Message, error) {
+	B, err := ReadWholeMessage(R)
+
+	if err != nil {
+		return nil, err
+	}
+
+	m := Message{}
+
+	err = m.decode(B)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
@@ -0,0 +1,138 @@
+package proto_test
+
+import (
+	"bytes"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/johnmcconnell/proto/slim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	B := bytes.NewBuffer(nil)
+	W, R := proto.Wrap(qik.NewProtocol(), B, B)
+
+	m := proto.NewMessage([]byte("hello"))
+	m.Header["content-type"] = "text/plain"
+	m.Header["trace-id"] = "abc123"
+
+	_, err := proto.WriteEnvelope(W, m)
+
+	require.Nil(
+		err,
+		"bytes not written",
+	)
+
+	_, err = proto.WriteEnvelope(W, &proto.Message{})
+
+	require.Nil(
+		err,
+		"bytes not written",
+	)
+
+	Received, err := proto.ReadEnvelope(R)
+
+	require.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		m.Header,
+		Received.Header,
+		"headers match",
+	)
+
+	assert.Equal(
+		"hello",
+		string(Received.Body),
+		"bytes match",
+	)
+
+	Received, err = proto.ReadEnvelope(R)
+
+	require.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Empty(
+		Received.Header,
+		"there are no headers",
+	)
+
+	assert.Empty(
+		Received.Body,
+		"there is no body",
+	)
+
+	_, err = proto.ReadEnvelope(R)
+
+	assert.Equal(
+		io.EOF,
+		err,
+		"the stream is over",
+	)
+}
+
+func TestTruncatedEnvelope(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+
+	proto.WriteEnvelope(slim.NewWriter(B), proto.NewMessage([]byte("hello")))
+
+	// drop the TerminalByte
+	B.Truncate(B.Len() - 1)
+
+	_, err := proto.ReadEnvelope(slim.NewReader(B))
+
+	assert.Equal(
+		io.ErrUnexpectedEOF,
+		err,
+		"the stream ended inside the envelope",
+	)
+}
+
+func TestEnvelopeEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	m := proto.Message{
+		Header: map[string]string{
+			"b": "2",
+			"a": "1",
+		},
+		Body: []byte("body"),
+	}
+
+	E := []byte{2, 1, 'a', 1, '1', 1, 'b', 1, '2', 'b', 'o', 'd', 'y'}
+
+	for i := 0; i < 10; i++ {
+		Encoded, err := m.MarshalBinary()
+
+		assert.Nil(
+			err,
+			"the message was encoded",
+		)
+
+		assert.Equal(
+			E,
+			Encoded,
+			"headers are encoded in key order",
+		)
+	}
+
+	for _, b := range [][]byte{nil, {1}, {1, 5, 'a'}, {200, 1}, {1, 1, 'a', 2, 'b'}} {
+		assert.Equal(
+			proto.ErrBadEnvelope,
+			m.UnmarshalBinary(b),
+			"the envelope is malformed",
+		)
+	}
+}
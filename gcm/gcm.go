@@ -0,0 +1,464 @@
+package gcm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"github.com/johnmcconnell/proto"
+	"io"
+	"net"
+	"sync"
+)
+
+const (
+	// SequenceSize the count of bytes in front of
+	// every sealed message holding its sequence number
+	SequenceSize = 8
+	// SaltSize the count of random bytes each side
+	// sends at the start of a connection
+	SaltSize = 32
+	// BufferSize the count of bytes the reader
+	// reads off of the inner reader at once
+	BufferSize = 512
+	// DirectionDialer marks nonces of messages
+	// written by the dialing side
+	DirectionDialer = 1
+	// DirectionListener marks nonces of messages
+	// written by the listening side
+	DirectionListener = 2
+)
+
+var (
+	// ErrReplay a message with a sequence number
+	// that was already read
+	ErrReplay = fmt.Errorf(
+		"gcm: replayed message",
+	)
+	// ErrReordered a message with a sequence number
+	// past the next one, a message was dropped or
+	// arrived out of order
+	ErrReordered = fmt.Errorf(
+		"gcm: message out of order",
+	)
+	// ErrTruncated a message too short to hold its
+	// sequence number and tag, or a stream that ended
+	// in the middle of a message
+	ErrTruncated = fmt.Errorf(
+		"gcm: truncated message",
+	)
+	// ErrAuthentication a message that failed to open
+	ErrAuthentication = fmt.Errorf(
+		"gcm: message authentication failed",
+	)
+	// ErrSessionReused a Session made a second reader
+	// or writer, it would reuse the nonces of the first
+	ErrSessionReused = fmt.Errorf(
+		"gcm: session already has a reader or writer",
+	)
+)
+
+// Protocol holds the pre-shared key of the inner
+// protocol. A connection must not seal with that key,
+// every one runs a Handshake and seals with the keys
+// of the Session it returns. The two sides of a
+// connection must not both be the Dialer
+type Protocol struct {
+	P      proto.Protocol
+	Key    []byte
+	Dialer bool
+}
+
+// Session seals every message of the inner protocol
+// with AES-GCM under the keys of one connection. The
+// nonce is made of the direction and a per direction
+// sequence counter, so a Session makes one reader and
+// one writer, the ones after fail with ErrSessionReused
+type Session struct {
+	P      proto.Protocol
+	Open   cipher.AEAD
+	Seal   cipher.AEAD
+	Dialer bool
+
+	mu      sync.Mutex
+	reading bool
+	writing bool
+}
+
+// broken fails every read and write
+type broken struct {
+	err error
+}
+
+// NewProtocol creates the protocol from a pre-shared
+// AES key of 16, 24 or 32 bytes
+func NewProtocol(P proto.Protocol, Key []byte, Dialer bool) (*Protocol, error) {
+	_, err := aes.NewCipher(Key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := Protocol{
+		P:      P,
+		Key:    append([]byte(nil), Key...),
+		Dialer: Dialer,
+	}
+
+	return &p, nil
+}
+
+// Handshake exchanges fresh random salts at the start
+// of a connection, the dialer's goes first. The keys of
+// both directions are derived from the pre-shared key
+// and both salts, so nonces never repeat across
+// connections and a message recorded on one
+// connection fails to open on any other
+func (p *Protocol) Handshake(c io.ReadWriter) (*Session, error) {
+	Mine := make([]byte, SaltSize)
+	Peer := make([]byte, SaltSize)
+
+	_, err := rand.Read(Mine)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Dialer {
+		_, err = c.Write(Mine)
+
+		if err == nil {
+			_, err = io.ReadFull(c, Peer)
+		}
+	} else {
+		_, err = io.ReadFull(c, Peer)
+
+		if err == nil {
+			_, err = c.Write(Mine)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	Salt := append(Peer, Mine...)
+
+	if p.Dialer {
+		Salt = append(Mine, Peer...)
+	}
+
+	Dialer, err := newAEAD(derive(p.Key, Salt, "gcm dialer"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	Listener, err := newAEAD(derive(p.Key, Salt, "gcm listener"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := Session{
+		P:      p.P,
+		Open:   Dialer,
+		Seal:   Listener,
+		Dialer: p.Dialer,
+	}
+
+	if p.Dialer {
+		s.Open, s.Seal = Listener, Dialer
+	}
+
+	return &s, nil
+}
+
+// Connect runs the Handshake over c, it is the
+// Handshake of a proto.Server, Pool or Listener
+func (p *Protocol) Connect(c net.Conn) (proto.Protocol, error) {
+	s, err := p.Handshake(c)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// WrapConn runs the Handshake over c and
+// wraps c with the Session
+func (p *Protocol) WrapConn(c net.Conn) (net.Conn, error) {
+	s, err := p.Handshake(c)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.WrapConn(s, c), nil
+}
+
+// NewReader ...
+func (s *Session) NewReader(R io.Reader) io.Reader {
+	if !s.claim(&s.reading) {
+		return broken{ErrSessionReused}
+	}
+
+	D := uint32(DirectionDialer)
+
+	if s.Dialer {
+		D = DirectionListener
+	}
+
+	return NewReader(s.P.NewReader(R), s.Open, D)
+}
+
+// NewWriter ...
+func (s *Session) NewWriter(W io.Writer) io.Writer {
+	if !s.claim(&s.writing) {
+		return broken{ErrSessionReused}
+	}
+
+	D := uint32(DirectionListener)
+
+	if s.Dialer {
+		D = DirectionDialer
+	}
+
+	return NewWriter(s.P.NewWriter(W), s.Seal, D)
+}
+
+// claim sets the flag, it returns
+// false if it was already set
+func (s *Session) claim(Used *bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if *Used {
+		return false
+	}
+
+	*Used = true
+
+	return true
+}
+
+// Read ...
+func (b broken) Read(p []byte) (int, error) {
+	return 0, b.err
+}
+
+// Write ...
+func (b broken) Write(p []byte) (int, error) {
+	return 0, b.err
+}
+
+// derive expands the pre-shared key into the key of
+// one direction with HKDF-SHA256, RFC 5869. The key
+// is never longer than one SHA-256 block
+func derive(Key []byte, Salt []byte, Info string) []byte {
+	H := hmac.New(sha256.New, Salt)
+	H.Write(Key)
+
+	PRK := H.Sum(nil)
+
+	H = hmac.New(sha256.New, PRK)
+	H.Write([]byte(Info))
+	H.Write([]byte{1})
+
+	return H.Sum(nil)[:len(Key)]
+}
+
+func newAEAD(Key []byte) (cipher.AEAD, error) {
+	B, err := aes.NewCipher(Key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(B)
+}
+
+// Reader opens every message read off of an inner
+// message reader, messages must arrive in order
+type Reader struct {
+	R         io.Reader
+	AEAD      cipher.AEAD
+	Direction uint32
+	Sequence  uint64
+	Nonce     []byte
+	Buff      []byte
+	Sealed    []byte
+	Plain     []byte
+	Started   bool
+}
+
+// Writer seals every message written to an inner
+// message writer, a message is held until it ends
+type Writer struct {
+	W         io.Writer
+	AEAD      cipher.AEAD
+	Direction uint32
+	Sequence  uint64
+	Nonce     []byte
+	Header    []byte
+	Plain     []byte
+	Sealed    []byte
+}
+
+// NewReader creates a new Reader over an inner
+// message reader, Direction is the one of the writer
+func NewReader(R io.Reader, AEAD cipher.AEAD, Direction uint32) *Reader {
+	r := Reader{
+		R:         R,
+		AEAD:      AEAD,
+		Direction: Direction,
+		Nonce:     make([]byte, AEAD.NonceSize()),
+		Buff:      make([]byte, BufferSize),
+	}
+
+	return &r
+}
+
+// NewWriter creates a new Writer over an
+// inner message writer
+func NewWriter(W io.Writer, AEAD cipher.AEAD, Direction uint32) *Writer {
+	w := Writer{
+		W:         W,
+		AEAD:      AEAD,
+		Direction: Direction,
+		Nonce:     make([]byte, AEAD.NonceSize()),
+		Header:    make([]byte, SequenceSize),
+	}
+
+	return &w
+}
+
+// nonce fills N with the direction and sequence
+func nonce(N []byte, Direction uint32, Sequence uint64) []byte {
+	L := len(N)
+
+	binary.BigEndian.PutUint32(N[L-12:], Direction)
+	binary.BigEndian.PutUint64(N[L-8:], Sequence)
+
+	return N
+}
+
+// Read reads the opened message bytes into b, it
+// returns proto.ErrEOM at the end of the message
+func (r *Reader) Read(b []byte) (int, error) {
+	if !r.Started {
+		err := r.open()
+
+		if err != nil {
+			return 0, err
+		}
+
+		r.Started = true
+	}
+
+	if len(r.Plain) == 0 {
+		r.Started = false
+
+		return 0, proto.ErrEOM
+	}
+
+	n := copy(b, r.Plain)
+	r.Plain = r.Plain[n:]
+
+	return n, nil
+}
+
+// open reads a whole sealed message and opens it
+func (r *Reader) open() error {
+	r.Sealed = r.Sealed[:0]
+
+	for {
+		n, err := r.R.Read(r.Buff)
+
+		r.Sealed = append(r.Sealed, r.Buff[:n]...)
+
+		if err == proto.ErrEOM {
+			break
+		}
+
+		if err == io.EOF && len(r.Sealed) > 0 {
+			return ErrTruncated
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(r.Sealed) < SequenceSize+r.AEAD.Overhead() {
+		return ErrTruncated
+	}
+
+	Sequence := binary.BigEndian.Uint64(r.Sealed)
+
+	if Sequence < r.Sequence {
+		return ErrReplay
+	}
+
+	if Sequence > r.Sequence {
+		return ErrReordered
+	}
+
+	N := nonce(r.Nonce, r.Direction, Sequence)
+
+	Plain, err := r.AEAD.Open(
+		r.Plain[:0],
+		N,
+		r.Sealed[SequenceSize:],
+		r.Sealed[:SequenceSize],
+	)
+
+	if err != nil {
+		return ErrAuthentication
+	}
+
+	r.Sequence++
+	r.Plain = Plain
+
+	return nil
+}
+
+// Write holds the bytes until the message ends, writing
+// the nil buffer or the empty buffer seals the message
+// and writes it to the inner writer
+func (w *Writer) Write(b []byte) (int, error) {
+	if len(b) > 0 {
+		w.Plain = append(w.Plain, b...)
+
+		return len(b), nil
+	}
+
+	N := nonce(w.Nonce, w.Direction, w.Sequence)
+
+	binary.BigEndian.PutUint64(w.Header, w.Sequence)
+
+	w.Sealed = append(w.Sealed[:0], w.Header...)
+	w.Sealed = w.AEAD.Seal(
+		w.Sealed,
+		N,
+		w.Plain,
+		w.Header,
+	)
+
+	w.Sequence++
+	w.Plain = w.Plain[:0]
+
+	_, err := w.W.Write(w.Sealed)
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = w.W.Write(nil)
+
+	return 0, err
+}
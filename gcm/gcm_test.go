@@ -0,0 +1,559 @@
+package gcm
+
+import (
+	"bytes"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"testing"
+)
+
+var key = []byte("0123456789abcdef0123456789abcdef")
+
+// sessions runs the handshake of both sides
+func sessions(t *testing.T, c net.Conn, d net.Conn) (*Session, *Session) {
+	Dialer, err := NewProtocol(qik.NewProtocol(), key, true)
+
+	require.Nil(
+		t,
+		err,
+		"could not create the protocol",
+	)
+
+	Listener, err := NewProtocol(qik.NewProtocol(), key, false)
+
+	require.Nil(
+		t,
+		err,
+		"could not create the protocol",
+	)
+
+	Done := make(chan *Session)
+
+	go func() {
+		L, _ := Listener.Handshake(d)
+
+		Done <- L
+	}()
+
+	D, err := Dialer.Handshake(c)
+
+	require.Nil(
+		t,
+		err,
+		"the handshake failed",
+	)
+
+	L := <-Done
+
+	require.NotNil(
+		t,
+		L,
+		"the handshake failed",
+	)
+
+	return D, L
+}
+
+// pair the sessions of a new connection
+func pair(t *testing.T) (*Session, *Session) {
+	c, d := net.Pipe()
+
+	defer c.Close()
+	defer d.Close()
+
+	return sessions(t, c, d)
+}
+
+// sealed writes each message to its own buffer
+// with a single writer
+func sealed(D *Session, Messages ...string) [][]byte {
+	var Sealed [][]byte
+
+	B := bytes.NewBuffer(nil)
+	W := D.NewWriter(B)
+
+	for _, m := range Messages {
+		proto.WriteMessage(W, []byte(m))
+
+		Sealed = append(Sealed, append([]byte(nil), B.Bytes()...))
+
+		B.Reset()
+	}
+
+	return Sealed
+}
+
+func reader(L *Session, Sealed ...[]byte) *Reader {
+	return L.NewReader(bytes.NewReader(bytes.Join(Sealed, nil))).(*Reader)
+}
+
+func TestWrapConn(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	Dialer, err := NewProtocol(qik.NewProtocol(), key, true)
+
+	require.Nil(
+		err,
+		"could not create the protocol",
+	)
+
+	Listener, err := NewProtocol(qik.NewProtocol(), key, false)
+
+	require.Nil(
+		err,
+		"could not create the protocol",
+	)
+
+	a, b := net.Pipe()
+
+	go func() {
+		B, err := Listener.WrapConn(b)
+
+		if err != nil {
+			return
+		}
+
+		for {
+			m, err := proto.ReadMessage(B)
+
+			if err != nil || len(m) == 0 {
+				return
+			}
+
+			proto.WriteMessage(B, bytes.ToUpper(m))
+		}
+	}()
+
+	A, err := Dialer.WrapConn(a)
+
+	require.Nil(
+		err,
+		"the handshake failed",
+	)
+
+	for _, m := range []string{"hello", "world"} {
+		_, err := proto.WriteMessage(A, []byte(m))
+
+		require.Nil(
+			err,
+			"bytes not written",
+		)
+
+		Received, err := proto.ReadMessage(A)
+
+		assert.Nil(
+			err,
+			"bytes not read",
+		)
+
+		assert.Equal(
+			string(bytes.ToUpper([]byte(m))),
+			string(Received),
+			"bytes match",
+		)
+	}
+
+	A.Close()
+}
+
+func TestConnections(t *testing.T) {
+	assert := assert.New(t)
+
+	D1, L1 := pair(t)
+	D2, L2 := pair(t)
+
+	S1 := sealed(D1, "transfer $100")
+	S2 := sealed(D2, "transfer $100")
+
+	assert.NotEqual(
+		S1[0],
+		S2[0],
+		"connections under the same key seal with their own keys",
+	)
+
+	_, err := proto.ReadMessage(reader(L2, S1[0]))
+
+	assert.Equal(
+		ErrAuthentication,
+		err,
+		"a message recorded on one connection fails on another",
+	)
+
+	Received, err := proto.ReadMessage(reader(L1, S1[0]))
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"transfer $100",
+		string(Received),
+		"bytes match",
+	)
+}
+
+func TestReplayedConnection(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// record the dialer's side of a whole connection
+	Recording := bytes.NewBuffer(nil)
+
+	c, d := net.Pipe()
+
+	defer c.Close()
+	defer d.Close()
+
+	Tee := struct {
+		io.Reader
+		io.Writer
+	}{c, io.MultiWriter(c, Recording)}
+
+	Dialer, err := NewProtocol(qik.NewProtocol(), key, true)
+
+	require.Nil(
+		err,
+		"could not create the protocol",
+	)
+
+	Listener, err := NewProtocol(qik.NewProtocol(), key, false)
+
+	require.Nil(
+		err,
+		"could not create the protocol",
+	)
+
+	go Listener.Handshake(d)
+
+	D, err := Dialer.Handshake(Tee)
+
+	require.Nil(
+		err,
+		"the handshake failed",
+	)
+
+	proto.WriteMessage(D.NewWriter(Recording), []byte("transfer $100"))
+
+	// play it to a fresh listener
+	Replay := struct {
+		io.Reader
+		io.Writer
+	}{Recording, io.Discard}
+
+	L, err := Listener.Handshake(Replay)
+
+	require.Nil(
+		err,
+		"the handshake failed",
+	)
+
+	_, err = proto.ReadMessage(L.NewReader(Replay))
+
+	assert.Equal(
+		ErrAuthentication,
+		err,
+		"the listener's salt is fresh",
+	)
+}
+
+func TestReplay(t *testing.T) {
+	assert := assert.New(t)
+
+	D, L := pair(t)
+	S := sealed(D, "first", "second")
+	R := reader(L, S[0], S[0])
+
+	Received, err := proto.ReadMessage(R)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"first",
+		string(Received),
+		"bytes match",
+	)
+
+	_, err = proto.ReadMessage(R)
+
+	assert.Equal(
+		ErrReplay,
+		err,
+		"the message was already read",
+	)
+}
+
+func TestReordered(t *testing.T) {
+	assert := assert.New(t)
+
+	D, L := pair(t)
+	S := sealed(D, "first", "second")
+	R := reader(L, S[1], S[0])
+
+	_, err := proto.ReadMessage(R)
+
+	assert.Equal(
+		ErrReordered,
+		err,
+		"the second message came first",
+	)
+}
+
+func TestTampered(t *testing.T) {
+	assert := assert.New(t)
+
+	D, L := pair(t)
+	S := sealed(D, "first")
+	T := append([]byte(nil), S[0]...)
+	T[len(T)-4] ^= 0x01
+
+	_, err := proto.ReadMessage(reader(L, T))
+
+	assert.Equal(
+		ErrAuthentication,
+		err,
+		"the message was changed",
+	)
+
+	// the dialer reading its own messages
+	_, err = proto.ReadMessage(D.NewReader(bytes.NewReader(S[0])))
+
+	assert.Equal(
+		ErrAuthentication,
+		err,
+		"the nonce is bound to the direction",
+	)
+}
+
+func TestTruncated(t *testing.T) {
+	assert := assert.New(t)
+
+	D, L := pair(t)
+	S := sealed(D, "first")
+
+	_, err := proto.ReadMessage(reader(L, S[0][:10]))
+
+	assert.Equal(
+		ErrTruncated,
+		err,
+		"the stream ended in the middle of the message",
+	)
+
+	B := bytes.NewBuffer(nil)
+	proto.WriteMessage(qik.NewWriter(B), []byte{0, 0, 0, 0, 0, 0, 0, 0, 1})
+
+	_, L = pair(t)
+
+	_, err = proto.ReadMessage(reader(L, B.Bytes()))
+
+	assert.Equal(
+		ErrTruncated,
+		err,
+		"the message is too short for its tag",
+	)
+}
+
+func TestSessionReused(t *testing.T) {
+	assert := assert.New(t)
+
+	D, _ := pair(t)
+
+	B := bytes.NewBuffer(nil)
+
+	_, err := proto.WriteMessage(D.NewWriter(B), []byte("first"))
+
+	assert.Nil(
+		err,
+		"bytes not written",
+	)
+
+	_, err = proto.WriteMessage(D.NewWriter(B), []byte("first"))
+
+	assert.Equal(
+		ErrSessionReused,
+		err,
+		"a second writer would reuse the nonces",
+	)
+
+	_, err = proto.ReadMessage(D.NewReader(B))
+
+	assert.NotEqual(
+		ErrSessionReused,
+		err,
+		"the first reader is made",
+	)
+
+	_, err = proto.ReadMessage(D.NewReader(B))
+
+	assert.Equal(
+		ErrSessionReused,
+		err,
+		"a second reader is refused",
+	)
+}
+
+func TestServerPool(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	Dialer, err := NewProtocol(qik.NewProtocol(), key, true)
+
+	require.Nil(
+		err,
+		"could not create the protocol",
+	)
+
+	Listener, err := NewProtocol(qik.NewProtocol(), key, false)
+
+	require.Nil(
+		err,
+		"could not create the protocol",
+	)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	require.Nil(
+		err,
+		"could not listen",
+	)
+
+	S := proto.NewServer(
+		nil,
+		proto.HandlerFunc(func(w io.Writer, m []byte) {
+			w.Write(bytes.ToUpper(m))
+		}),
+	)
+	S.Handshake = Listener.Connect
+
+	go S.Serve(l)
+	defer S.Close()
+
+	P := proto.NewPool(
+		nil,
+		func() (net.Conn, error) {
+			return net.Dial("tcp", l.Addr().String())
+		},
+	)
+	P.Handshake = Dialer.Connect
+	defer P.Close()
+
+	for _, m := range []string{"hello", "world"} {
+		C, err := P.Get()
+
+		require.Nil(
+			err,
+			"could not get a connection",
+		)
+
+		_, err = proto.WriteMessage(C, []byte(m))
+
+		require.Nil(
+			err,
+			"bytes not written",
+		)
+
+		Received, err := proto.ReadMessage(C)
+
+		assert.Nil(
+			err,
+			"bytes not read",
+		)
+
+		assert.Equal(
+			string(bytes.ToUpper([]byte(m))),
+			string(Received),
+			"bytes match",
+		)
+
+		P.Put(C)
+	}
+
+	assert.Equal(
+		1,
+		P.Open(),
+		"the sealed connection is reused",
+	)
+}
+
+func TestListener(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	Dialer, err := NewProtocol(qik.NewProtocol(), key, true)
+
+	require.Nil(
+		err,
+		"could not create the protocol",
+	)
+
+	Listener, err := NewProtocol(qik.NewProtocol(), key, false)
+
+	require.Nil(
+		err,
+		"could not create the protocol",
+	)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	require.Nil(
+		err,
+		"could not listen",
+	)
+
+	L := proto.Listener{
+		Listener:  l,
+		Handshake: Listener.Connect,
+	}
+	defer L.Close()
+
+	go func() {
+		c, err := L.Accept()
+
+		if err != nil {
+			return
+		}
+
+		defer c.Close()
+
+		m, _ := proto.ReadMessage(c)
+		proto.WriteMessage(c, m)
+	}()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+
+	require.Nil(
+		err,
+		"could not dial",
+	)
+
+	C, err := Dialer.WrapConn(c)
+
+	require.Nil(
+		err,
+		"the handshake failed",
+	)
+	defer C.Close()
+
+	proto.WriteMessage(C, []byte("hello"))
+
+	Received, err := proto.ReadMessage(C)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"hello",
+		string(Received),
+		"bytes match",
+	)
+}
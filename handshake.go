@@ -0,0 +1,252 @@
+package proto
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+)
+
+const (
+	// HandshakeVersion the version of the handshake
+	// sent after the magic bytes
+	HandshakeVersion = 1
+	// HandshakeOK the listener accepted a protocol
+	HandshakeOK = 0
+	// HandshakeNoProtocol the listener supports
+	// none of the offered protocols
+	HandshakeNoProtocol = 1
+	// HandshakeBadVersion the listener does not
+	// speak the dialer's handshake version
+	HandshakeBadVersion = 2
+)
+
+var (
+	// HandshakeMagic the bytes that start both
+	// sides of the handshake
+	HandshakeMagic = []byte("PRTO")
+
+	// ErrHandshakeMagic the peer did not start
+	// with the magic bytes
+	ErrHandshakeMagic = fmt.Errorf(
+		"proto: handshake magic bytes do not match",
+	)
+	// ErrHandshakeVersion the peer speaks another
+	// version of the handshake
+	ErrHandshakeVersion = fmt.Errorf(
+		"proto: handshake version is not supported",
+	)
+	// ErrNoProtocol the two sides share no protocol
+	ErrNoProtocol = fmt.Errorf(
+		"proto: no protocol in common",
+	)
+)
+
+// NamedProtocol a Protocol and the name it
+// goes by in the handshake
+type NamedProtocol struct {
+	Name     string
+	Protocol Protocol
+}
+
+// Negotiate runs the dialing side of the handshake,
+// the protocols are offered in order of preference.
+// It returns the connection wrapped with the protocol
+// the listener chose and that protocol's name
+func Negotiate(c net.Conn, Offers []NamedProtocol) (net.Conn, string, error) {
+	if len(Offers) == 0 || len(Offers) > 0xFF {
+		return nil, "", fmt.Errorf(
+			"proto: can not offer %v protocols",
+			len(Offers),
+		)
+	}
+
+	B := bytes.NewBuffer(nil)
+
+	B.Write(HandshakeMagic)
+	B.WriteByte(HandshakeVersion)
+	B.WriteByte(byte(len(Offers)))
+
+	for _, O := range Offers {
+		if len(O.Name) == 0 || len(O.Name) > 0xFF {
+			return nil, "", fmt.Errorf(
+				"proto: protocol name [%v] must be 1 to 255 bytes",
+				O.Name,
+			)
+		}
+
+		B.WriteByte(byte(len(O.Name)))
+		B.WriteString(O.Name)
+	}
+
+	_, err := c.Write(B.Bytes())
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = readPreamble(c)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	Status, err := readByte(c)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	Name, err := readName(c)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch Status {
+	case HandshakeOK:
+
+	case HandshakeNoProtocol:
+		return nil, "", ErrNoProtocol
+
+	case HandshakeBadVersion:
+		return nil, "", ErrHandshakeVersion
+
+	default:
+		return nil, "", fmt.Errorf(
+			"proto: unknown handshake status [%v]",
+			Status,
+		)
+	}
+
+	for _, O := range Offers {
+		if O.Name == Name {
+			return WrapConn(O.Protocol, c), Name, nil
+		}
+	}
+
+	return nil, "", fmt.Errorf(
+		"proto: listener chose [%v] which was not offered",
+		Name,
+	)
+}
+
+// AcceptNegotiation runs the listening side of the
+// handshake. The first offered protocol that is
+// also Supported is chosen and confirmed, the
+// connection is returned wrapped with it
+func AcceptNegotiation(c net.Conn, Supported []NamedProtocol) (net.Conn, string, error) {
+	err := readPreamble(c)
+
+	if err == ErrHandshakeVersion {
+		reply(c, HandshakeBadVersion, "")
+
+		return nil, "", err
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	Count, err := readByte(c)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	var Chosen *NamedProtocol
+
+	for i := 0; i < int(Count); i++ {
+		Name, err := readName(c)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		if Chosen != nil {
+			continue
+		}
+
+		for j := range Supported {
+			if Supported[j].Name == Name {
+				Chosen = &Supported[j]
+
+				break
+			}
+		}
+	}
+
+	if Chosen == nil {
+		reply(c, HandshakeNoProtocol, "")
+
+		return nil, "", ErrNoProtocol
+	}
+
+	err = reply(c, HandshakeOK, Chosen.Name)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return WrapConn(Chosen.Protocol, c), Chosen.Name, nil
+}
+
+// reply writes the listener's answer
+func reply(W io.Writer, Status byte, Name string) error {
+	B := bytes.NewBuffer(nil)
+
+	B.Write(HandshakeMagic)
+	B.WriteByte(HandshakeVersion)
+	B.WriteByte(Status)
+	B.WriteByte(byte(len(Name)))
+	B.WriteString(Name)
+
+	_, err := W.Write(B.Bytes())
+
+	return err
+}
+
+// readPreamble reads and checks the
+// magic bytes and the version
+func readPreamble(R io.Reader) error {
+	B := make([]byte, len(HandshakeMagic)+1)
+
+	_, err := io.ReadFull(R, B)
+
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(B[:len(HandshakeMagic)], HandshakeMagic) {
+		return ErrHandshakeMagic
+	}
+
+	if B[len(HandshakeMagic)] != HandshakeVersion {
+		return ErrHandshakeVersion
+	}
+
+	return nil
+}
+
+func readByte(R io.Reader) (byte, error) {
+	B := make([]byte, 1)
+
+	_, err := io.ReadFull(R, B)
+
+	return B[0], err
+}
+
+// readName reads a length prefixed name
+func readName(R io.Reader) (string, error) {
+	L, err := readByte(R)
+
+	if err != nil {
+		return "", err
+	}
+
+	B := make([]byte, L)
+
+	_, err = io.ReadFull(R, B)
+
+	return string(B), err
+}
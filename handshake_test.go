@@ -0,0 +1,197 @@
+package proto_test
+
+import (
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/johnmcconnell/proto/slim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"testing"
+)
+
+var (
+	qikNamed = proto.NamedProtocol{
+		Name:     "qik",
+		Protocol: qik.NewProtocol(),
+	}
+	slimNamed = proto.NamedProtocol{
+		Name:     "slim",
+		Protocol: slim.NewProtocol(),
+	}
+)
+
+type negotiated struct {
+	C    net.Conn
+	Name string
+	Err  error
+}
+
+func negotiate(Offers, Supported []proto.NamedProtocol) (negotiated, negotiated) {
+	a, b := net.Pipe()
+
+	done := make(chan negotiated)
+
+	go func() {
+		C, Name, err := proto.AcceptNegotiation(b, Supported)
+
+		if err != nil {
+			b.Close()
+		}
+
+		done <- negotiated{C, Name, err}
+	}()
+
+	C, Name, err := proto.Negotiate(a, Offers)
+
+	return negotiated{C, Name, err}, <-done
+}
+
+func TestNegotiate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	D, L := negotiate(
+		[]proto.NamedProtocol{slimNamed, qikNamed},
+		[]proto.NamedProtocol{qikNamed, slimNamed},
+	)
+
+	require.Nil(
+		D.Err,
+		"the dialer negotiated",
+	)
+
+	require.Nil(
+		L.Err,
+		"the listener negotiated",
+	)
+
+	assert.Equal(
+		"slim",
+		D.Name,
+		"the dialer's first choice wins",
+	)
+
+	assert.Equal(
+		"slim",
+		L.Name,
+		"both sides agree",
+	)
+
+	go proto.WriteMessage(D.C, []byte("hello"))
+
+	Received, err := proto.ReadMessage(L.C)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"hello",
+		string(Received),
+		"both sides use the chosen protocol",
+	)
+
+	D, L = negotiate(
+		[]proto.NamedProtocol{{Name: "future", Protocol: qik.NewProtocol()}, qikNamed},
+		[]proto.NamedProtocol{qikNamed},
+	)
+
+	assert.Equal(
+		"qik",
+		D.Name,
+		"unknown protocols are skipped",
+	)
+}
+
+func TestNegotiateNoProtocol(t *testing.T) {
+	assert := assert.New(t)
+
+	D, L := negotiate(
+		[]proto.NamedProtocol{slimNamed},
+		[]proto.NamedProtocol{qikNamed},
+	)
+
+	assert.Equal(
+		proto.ErrNoProtocol,
+		D.Err,
+		"the dialer learns there is no match",
+	)
+
+	assert.Equal(
+		proto.ErrNoProtocol,
+		L.Err,
+		"the listener has no match",
+	)
+}
+
+func TestNegotiateBadMagic(t *testing.T) {
+	assert := assert.New(t)
+
+	a, b := net.Pipe()
+
+	// a peer that skips the handshake
+	go proto.WriteMessage(qik.NewWriter(a), []byte("hello world"))
+
+	_, _, err := proto.AcceptNegotiation(b, []proto.NamedProtocol{qikNamed})
+
+	assert.Equal(
+		proto.ErrHandshakeMagic,
+		err,
+		"the peer did not send the magic bytes",
+	)
+}
+
+func TestServerNegotiate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	S, addr, _ := startServer(
+		t,
+		proto.HandlerFunc(func(w io.Writer, m []byte) {
+			w.Write(m)
+		}),
+		func(S *proto.Server) {
+			S.Protocols = []proto.NamedProtocol{qikNamed, slimNamed}
+		},
+	)
+	defer S.Close()
+
+	c, err := net.Dial("tcp", addr)
+
+	require.Nil(
+		err,
+		"could not dial",
+	)
+
+	C, Name, err := proto.Negotiate(c, []proto.NamedProtocol{slimNamed})
+
+	require.Nil(
+		err,
+		"could not negotiate",
+	)
+	defer C.Close()
+
+	assert.Equal(
+		"slim",
+		Name,
+		"the server supports slim",
+	)
+
+	proto.WriteMessage(C, []byte("echo"))
+
+	Received, err := proto.ReadMessage(C)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"echo",
+		string(Received),
+		"bytes match",
+	)
+}
@@ -0,0 +1,440 @@
+package hdlc
+
+import (
+	"fmt"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/internal/flat"
+	"io"
+)
+
+const (
+	// BufferSize the count of bytes the buffer can hold
+	BufferSize = 512
+	// DefaultMaxFrame the largest message read
+	// when the protocol sets no Max
+	DefaultMaxFrame = 64 * 1024
+	// Flag starts and ends every frame
+	Flag = 0x7E
+	// Escape the next byte is XORed with Flip
+	Escape = 0x7D
+	// Flip undoes an escape
+	Flip = 0x20
+	// InitFCS the FCS of no bytes
+	InitFCS = 0xFFFF
+	// GoodFCS the FCS of a frame and
+	// its own FCS when they match
+	GoodFCS = 0xF0B8
+)
+
+var (
+	// ErrShortFrame a frame is too
+	// short to hold its FCS
+	ErrShortFrame = fmt.Errorf(
+		"hdlc: frame shorter than its FCS",
+	)
+	// ErrAborted a frame ended with an
+	// Escape followed by a Flag
+	ErrAborted = fmt.Errorf(
+		"hdlc: frame aborted",
+	)
+
+	fcsTable [256]uint16
+)
+
+func init() {
+	for i := range fcsTable {
+		x := uint16(i)
+
+		for j := 0; j < 8; j++ {
+			if x&1 == 1 {
+				x = x>>1 ^ 0x8408
+			} else {
+				x >>= 1
+			}
+		}
+
+		fcsTable[i] = x
+	}
+
+	proto.Register("hdlc", func() proto.Protocol {
+		return NewProtocol()
+	})
+}
+
+// FCSError a frame failed its frame check sequence
+type FCSError struct {
+	FCS  uint16
+	Want uint16
+}
+
+// Error ...
+func (e *FCSError) Error() string {
+	return fmt.Sprintf(
+		"hdlc: frame check sequence is %#04x but the frame sums to %#04x",
+		e.FCS,
+		e.Want,
+	)
+}
+
+// FCS16 adds the bytes to the CRC-16/X.25 frame
+// check sequence, start with InitFCS. A frame is
+// sent with the complement of its FCS, low byte first
+func FCS16(fcs uint16, b []byte) uint16 {
+	for _, c := range b {
+		fcs = fcs>>8 ^ fcsTable[byte(fcs)^c]
+	}
+
+	return fcs
+}
+
+// Protocol frames messages as RFC 1662 HDLC-like
+// async frames, each message followed by its FCS
+// between Flag bytes. Frames that fail the FCS
+// return an *FCSError, or are dropped with
+// SkipBadFrames. EscapeControl also escapes the
+// bytes below 0x20 for links that eat them. Max
+// of zero means DefaultMaxFrame
+type Protocol struct {
+	Max           int
+	SkipBadFrames bool
+	EscapeControl bool
+}
+
+// NewReader ...
+func (p *Protocol) NewReader(R io.Reader) io.Reader {
+	r := NewReader(R)
+	r.SkipBadFrames = p.SkipBadFrames
+
+	if p.Max > 0 {
+		r.Max = p.Max
+	}
+
+	return r
+}
+
+// NewWriter ...
+func (p *Protocol) NewWriter(W io.Writer) io.Writer {
+	w := NewWriter(W)
+	w.EscapeControl = p.EscapeControl
+
+	return w
+}
+
+// NewProtocol ...
+func NewProtocol() *Protocol {
+	p := Protocol{}
+
+	return &p
+}
+
+// Reader read messages using this Reader. A frame
+// is held in Frame until its FCS is checked, then
+// handed out from Out. Empty frames, such as the
+// ones shared flags make, are dropped. Messages
+// past Max bytes are skipped and return
+// proto.ErrMessageTooLarge
+type Reader struct {
+	R             io.Reader
+	Buff          []byte
+	Pending       []byte
+	Err           error
+	Frame         []byte
+	Out           []byte
+	Ready         bool
+	Escape        bool
+	Skip          bool
+	SkipBadFrames bool
+	Max           int
+}
+
+// Writer encode messages using this Writer,
+// the FCS of the message so far is kept in FCS
+type Writer struct {
+	W             io.Writer
+	EscapeControl bool
+	Open          bool
+	FCS           uint16
+
+	flat flat.Buffer
+}
+
+// NewReader creates a new Reader that
+// will decode messages from an io.Reader
+func NewReader(R io.Reader) *Reader {
+	r := Reader{
+		R:    R,
+		Buff: make([]byte, BufferSize),
+		Max:  DefaultMaxFrame,
+	}
+
+	return &r
+}
+
+// NewWriter creates a new Writer that
+// will encode messages to an io.Writer
+func NewWriter(W io.Writer) *Writer {
+	w := Writer{
+		W: W,
+	}
+
+	w.flat.Encode = w.message
+
+	return &w
+}
+
+// Read reads the checked frame into b, it
+// returns proto.ErrEOM at its end
+func (r *Reader) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	for {
+		if r.Ready {
+			if len(r.Out) == 0 {
+				r.Ready = false
+				r.Frame = r.Frame[:0]
+
+				return 0, proto.ErrEOM
+			}
+
+			n := copy(b, r.Out)
+
+			r.Out = r.Out[n:]
+
+			return n, nil
+		}
+
+		if len(r.Pending) == 0 {
+			if r.Err == io.EOF && (len(r.Frame) > 0 || r.Skip) {
+				return 0, io.ErrUnexpectedEOF
+			}
+
+			if r.Err != nil {
+				return 0, r.readErr()
+			}
+
+			n, err := r.R.Read(r.Buff)
+
+			r.Pending = r.Buff[:n]
+			r.Err = err
+
+			continue
+		}
+
+		err := r.collect()
+
+		if err == nil {
+			continue
+		}
+
+		if r.SkipBadFrames && err != proto.ErrMessageTooLarge {
+			continue
+		}
+
+		return 0, err
+	}
+}
+
+// SetMaxMessageSize ...
+func (r *Reader) SetMaxMessageSize(Max int) {
+	r.Max = Max
+}
+
+// readErr hands back the read error, only io.EOF
+// is kept so a read past a deadline can be retried
+func (r *Reader) readErr() error {
+	err := r.Err
+
+	if err != io.EOF {
+		r.Err = nil
+	}
+
+	return err
+}
+
+// collect unescapes the pending bytes into
+// Frame up to the next Flag
+func (r *Reader) collect() error {
+	for i, c := range r.Pending {
+		switch {
+		case c == Flag:
+			r.Pending = r.Pending[i+1:]
+
+			return r.end()
+
+		case r.Escape:
+			r.Escape = false
+
+			r.append(c ^ Flip)
+
+		case c == Escape:
+			r.Escape = true
+
+		default:
+			r.append(c)
+		}
+	}
+
+	r.Pending = nil
+
+	return nil
+}
+
+// append adds a byte to the frame, the
+// FCS may take it two bytes past Max
+func (r *Reader) append(c byte) {
+	if r.Skip {
+		return
+	}
+
+	if r.Max > 0 && len(r.Frame) >= r.Max+2 {
+		r.Skip = true
+		r.Frame = r.Frame[:0]
+
+		return
+	}
+
+	r.Frame = append(r.Frame, c)
+}
+
+// end checks the frame at its closing Flag
+func (r *Reader) end() error {
+	F := r.Frame
+	r.Frame = r.Frame[:0]
+
+	if r.Escape {
+		r.Escape = false
+		r.Skip = false
+
+		return ErrAborted
+	}
+
+	if r.Skip {
+		r.Skip = false
+
+		return proto.ErrMessageTooLarge
+	}
+
+	if len(F) == 0 {
+		return nil
+	}
+
+	if len(F) < 2 {
+		return ErrShortFrame
+	}
+
+	if FCS16(InitFCS, F) != GoodFCS {
+		L := len(F) - 2
+
+		e := FCSError{
+			FCS:  uint16(F[L]) | uint16(F[L+1])<<8,
+			Want: ^FCS16(InitFCS, F[:L]),
+		}
+
+		return &e
+	}
+
+	r.Frame = F
+	r.Out = F[:len(F)-2]
+	r.Ready = true
+
+	return nil
+}
+
+// Write encodes the bytes to the underlying
+// writer, writing the nil buffer or the empty
+// buffer writes the FCS and the closing Flag
+func (w *Writer) Write(b []byte) (int, error) {
+	Flat := w.flat.Bytes()
+
+	if len(b) == 0 {
+		Flat = w.end(w.open(Flat))
+	} else {
+		Flat = w.encode(w.open(Flat), b)
+	}
+
+	_, err := w.flat.Write(w.W, Flat)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// WriteMessage writes the whole message
+// in a single write
+func (w *Writer) WriteMessage(b []byte) (int, error) {
+	return w.flat.WriteMessages(w.W, b)
+}
+
+// WriteMessages writes every message
+// in a single write
+func (w *Writer) WriteMessages(msgs ...[]byte) (int, error) {
+	return w.flat.WriteMessages(w.W, msgs...)
+}
+
+// message appends the whole frame, frames
+// written together share the Flag between them
+func (w *Writer) message(Flat []byte, m []byte) ([]byte, error) {
+	// the closing flag opens the next frame
+	if len(Flat) > 0 {
+		w.Open = true
+	}
+
+	Flat = w.encode(w.open(Flat), m)
+
+	return w.end(Flat), nil
+}
+
+// open appends the opening Flag
+// if the frame has not started
+func (w *Writer) open(Flat []byte) []byte {
+	if w.Open {
+		return Flat
+	}
+
+	w.Open = true
+	w.FCS = InitFCS
+
+	return append(Flat, Flag)
+}
+
+// encode appends the escaped bytes
+// and adds them to the FCS
+func (w *Writer) encode(Flat []byte, b []byte) []byte {
+	w.FCS = FCS16(w.FCS, b)
+
+	return w.escape(Flat, b)
+}
+
+// escape appends the bytes, escaping the Flag,
+// the Escape and, with EscapeControl, bytes
+// below 0x20
+func (w *Writer) escape(Flat []byte, b []byte) []byte {
+	for _, c := range b {
+		if c == Flag || c == Escape || (w.EscapeControl && c < 0x20) {
+			Flat = append(Flat, Escape, c^Flip)
+
+			continue
+		}
+
+		Flat = append(Flat, c)
+	}
+
+	return Flat
+}
+
+// end appends the complement of the FCS,
+// low byte first, and the closing Flag
+func (w *Writer) end(Flat []byte) []byte {
+	fcs := ^w.FCS
+
+	Flat = w.escape(Flat, []byte{byte(fcs), byte(fcs >> 8)})
+
+	w.Open = false
+	w.FCS = InitFCS
+
+	return append(Flat, Flag)
+}
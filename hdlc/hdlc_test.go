@@ -0,0 +1,384 @@
+package hdlc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/johnmcconnell/proto"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"testing"
+	"testing/iotest"
+)
+
+// flaky fails its first read like a
+// read past a deadline
+type flaky struct {
+	R      io.Reader
+	Failed bool
+}
+
+func (f *flaky) Read(b []byte) (int, error) {
+	if !f.Failed {
+		f.Failed = true
+
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	return f.R.Read(b)
+}
+
+func randomBytes(S int) ([]byte, error) {
+	BS := make([]byte, S)
+
+	_, err := rand.Read(BS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return BS, err
+}
+
+func TestFCS16(t *testing.T) {
+	assert := assert.New(t)
+
+	M := []byte("123456789")
+
+	assert.Equal(
+		uint16(0x906E),
+		^FCS16(InitFCS, M),
+		"the CRC-16/X.25 check value",
+	)
+
+	assert.Equal(
+		uint16(GoodFCS),
+		FCS16(InitFCS, append(M, 0x6E, 0x90)),
+		"a frame and its FCS sum to the good FCS",
+	)
+}
+
+func TestEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+
+	proto.WriteMessage(NewWriter(B), []byte("123456789"))
+
+	assert.Equal(
+		append(append([]byte{Flag}, "123456789"...), 0x6E, 0x90, Flag),
+		B.Bytes(),
+		"the FCS follows the message low byte first",
+	)
+
+	M := []byte{0x01, Flag, 0x02, Escape, 0x03}
+
+	B.Reset()
+
+	W := NewWriter(B)
+
+	W.Write(M[:2])
+	W.Write(M[2:])
+	W.Write(nil)
+
+	fcs := ^FCS16(InitFCS, M)
+
+	assert.Equal(
+		[]byte{Flag, 0x01, Escape, 0x5E, 0x02, Escape, 0x5D, 0x03, byte(fcs), byte(fcs >> 8), Flag},
+		B.Bytes(),
+		"Flag and Escape are escaped",
+	)
+
+	B.Reset()
+
+	p := NewProtocol()
+	p.EscapeControl = true
+
+	proto.WriteMessages(p.NewWriter(B), []byte{0x11}, []byte{0x41})
+
+	F := B.Bytes()
+
+	assert.Equal(
+		[]byte{Flag, Escape, 0x31},
+		F[:3],
+		"control bytes are escaped",
+	)
+
+	assert.Equal(
+		3,
+		bytes.Count(F, []byte{Flag}),
+		"frames written together share a Flag",
+	)
+
+	assert.Equal(
+		byte(0x41),
+		F[len(F)-4],
+		"the second frame follows the shared Flag",
+	)
+}
+
+func TestDecoding(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+
+	// line noise before the first frame is
+	// a frame that fails its FCS
+	B.Write([]byte{0x55, 0x66, 0x77})
+	proto.WriteMessages(NewWriter(B), []byte{0x01, Flag, 0x02, Escape}, []byte("hdlc"))
+	B.Write([]byte{Flag, Flag})
+
+	In := B.Bytes()
+
+	for _, R := range []io.Reader{bytes.NewReader(In), iotest.OneByteReader(bytes.NewReader(In))} {
+		D := NewReader(R)
+
+		_, err := proto.ReadMessage(D)
+
+		_, ok := err.(*FCSError)
+
+		assert.True(
+			ok,
+			"the line noise fails its FCS",
+		)
+
+		for _, m := range [][]byte{{0x01, Flag, 0x02, Escape}, []byte("hdlc")} {
+			Received, err := proto.ReadMessage(D)
+
+			assert.Nil(
+				err,
+				"bytes not read",
+			)
+
+			assert.Equal(
+				m,
+				Received,
+				"bytes match and empty frames are dropped",
+			)
+		}
+
+		_, err = D.Read(make([]byte, 16))
+
+		assert.Equal(
+			io.EOF,
+			err,
+			"the stream is over",
+		)
+	}
+
+	_, err := proto.ReadMessage(NewReader(bytes.NewReader([]byte{Flag, 0x01, 0x02})))
+
+	assert.Equal(
+		io.ErrUnexpectedEOF,
+		err,
+		"the stream ends inside a frame",
+	)
+}
+
+func TestBadFrames(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+	W := NewWriter(B)
+
+	proto.WriteMessage(W, []byte("good"))
+	proto.WriteMessage(W, []byte("flipped"))
+
+	// flip a bit in the second frame
+	In := B.Bytes()
+	In[len(In)-5] ^= 0x01
+
+	B.Write([]byte{Flag, 0x01, Flag})
+	B.Write([]byte{Flag, 0x01, 0x02, Escape, Flag})
+	proto.WriteMessage(W, []byte("last"))
+
+	In = B.Bytes()
+
+	D := NewReader(bytes.NewReader(In))
+
+	Received, err := proto.ReadMessage(D)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"good",
+		string(Received),
+		"bytes match",
+	)
+
+	_, err = proto.ReadMessage(D)
+
+	e, ok := err.(*FCSError)
+
+	assert.True(
+		ok,
+		"the flipped frame fails its FCS",
+	)
+
+	if ok {
+		assert.NotEqual(
+			e.FCS,
+			e.Want,
+			"the sums differ",
+		)
+	}
+
+	for _, E := range []error{ErrShortFrame, ErrAborted} {
+		_, err = proto.ReadMessage(D)
+
+		assert.Equal(
+			E,
+			err,
+			"the bad frame is reported",
+		)
+	}
+
+	Received, err = proto.ReadMessage(D)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"last",
+		string(Received),
+		"the reader picks up at the next frame",
+	)
+
+	p := NewProtocol()
+	p.SkipBadFrames = true
+
+	D = p.NewReader(bytes.NewReader(In)).(*Reader)
+
+	for _, m := range []string{"good", "last"} {
+		Received, err := proto.ReadMessage(D)
+
+		assert.Nil(
+			err,
+			"bad frames are skipped",
+		)
+
+		assert.Equal(
+			m,
+			string(Received),
+			"bytes match",
+		)
+	}
+}
+
+func TestRandom(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, EscapeControl := range []bool{false, true} {
+		p := NewProtocol()
+		p.EscapeControl = EscapeControl
+
+		B := bytes.NewBuffer(nil)
+		W, R := proto.Wrap(p, B, B)
+
+		var Messages [][]byte
+
+		for _, S := range []int{1, 100, 1000, 60000} {
+			m, err := randomBytes(S)
+
+			assert.Nil(
+				err,
+				"could not create random bytes",
+			)
+
+			Messages = append(Messages, m)
+		}
+
+		proto.WriteMessages(W, Messages...)
+
+		for _, m := range Messages {
+			Received, err := proto.ReadMessage(R)
+
+			assert.Nil(
+				err,
+				"bytes not read",
+			)
+
+			assert.True(
+				bytes.Equal(m, Received),
+				"bytes match",
+			)
+		}
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+	W, R := proto.Wrap(NewProtocol(), B, B)
+
+	proto.WriteMessages(W, []byte("small"), bytes.Repeat([]byte{Flag}, 1000), []byte("again"))
+
+	R = proto.LimitMessages(R, 100)
+
+	for _, E := range []error{nil, proto.ErrMessageTooLarge, nil} {
+		_, err := proto.ReadMessage(R)
+
+		assert.Equal(
+			E,
+			err,
+			"messages past the max are skipped",
+		)
+	}
+
+	p := NewProtocol()
+	p.Max = 100
+	p.SkipBadFrames = true
+
+	B.Reset()
+
+	proto.WriteMessages(NewWriter(B), []byte("small"), make([]byte, 101), []byte("again"))
+
+	R = p.NewReader(bytes.NewReader(B.Bytes()))
+
+	for _, E := range []error{nil, proto.ErrMessageTooLarge, nil} {
+		_, err := proto.ReadMessage(R)
+
+		assert.Equal(
+			E,
+			err,
+			"messages past the max are reported even when skipping bad frames",
+		)
+	}
+}
+
+func TestReadAfterTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+
+	proto.WriteMessage(NewWriter(B), []byte("after"))
+
+	R := NewReader(&flaky{R: B})
+
+	_, err := proto.ReadMessage(R)
+
+	assert.Equal(
+		os.ErrDeadlineExceeded,
+		err,
+		"the read timed out",
+	)
+
+	Received, err := proto.ReadMessage(R)
+
+	assert.Nil(
+		err,
+		"the reader recovers from a timeout",
+	)
+
+	assert.Equal(
+		"after",
+		string(Received),
+		"bytes match",
+	)
+}
@@ -0,0 +1,66 @@
+// Package flat holds the buffer message writers
+// encode whole messages into, so a batch goes
+// out in a single write
+package flat
+
+import (
+	"github.com/johnmcconnell/proto"
+	"io"
+)
+
+// Buffer encodes messages with Encode into a flat
+// buffer, it is kept for the next write unless it
+// grew past proto.MaxPooledBufferSize
+type Buffer struct {
+	B      []byte
+	Encode func(Flat []byte, m []byte) ([]byte, error)
+}
+
+// Bytes the empty buffer to append to
+func (f *Buffer) Bytes() []byte {
+	return f.B[:0]
+}
+
+// WriteMessages encodes every message and writes
+// them to W in a single write, returns the count
+// of message bytes written
+func (f *Buffer) WriteMessages(W io.Writer, msgs ...[]byte) (int, error) {
+	Flat := f.Bytes()
+	S := 0
+
+	for _, m := range msgs {
+		var err error
+
+		Flat, err = f.Encode(Flat, m)
+
+		if err != nil {
+			return 0, err
+		}
+
+		S += len(m)
+	}
+
+	n, err := f.Write(W, Flat)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if n < len(Flat) {
+		return 0, io.ErrShortWrite
+	}
+
+	return S, nil
+}
+
+// Write writes bytes appended to Bytes
+// to W in a single write
+func (f *Buffer) Write(W io.Writer, Flat []byte) (int, error) {
+	f.B = Flat[:0]
+
+	if cap(Flat) > proto.MaxPooledBufferSize {
+		f.B = nil
+	}
+
+	return W.Write(Flat)
+}
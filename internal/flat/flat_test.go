@@ -0,0 +1,67 @@
+package flat
+
+import (
+	"bytes"
+	"github.com/johnmcconnell/proto"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+// shortWriter writes one byte less than asked
+type shortWriter struct{}
+
+func (shortWriter) Write(b []byte) (int, error) {
+	return len(b) - 1, nil
+}
+
+func TestBuffer(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+
+	F := Buffer{
+		Encode: func(Flat []byte, m []byte) ([]byte, error) {
+			return append(append(Flat, m...), ';'), nil
+		},
+	}
+
+	n, err := F.WriteMessages(B, []byte("one"), []byte("two"))
+
+	assert.Nil(
+		err,
+		"bytes not written",
+	)
+
+	assert.Equal(
+		6,
+		n,
+		"the message bytes were counted",
+	)
+
+	assert.Equal(
+		"one;two;",
+		B.String(),
+		"the messages were encoded in order",
+	)
+
+	assert.True(
+		cap(F.B) > 0,
+		"the buffer is kept",
+	)
+
+	F.WriteMessages(B, make([]byte, proto.MaxPooledBufferSize))
+
+	assert.Nil(
+		F.B,
+		"a buffer past the max is dropped",
+	)
+
+	_, err = F.WriteMessages(shortWriter{}, []byte("short"))
+
+	assert.Equal(
+		io.ErrShortWrite,
+		err,
+		"a short write is an error",
+	)
+}
@@ -0,0 +1,420 @@
+package lenprefix
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/internal/flat"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	maxInt = int(^uint(0) >> 1)
+)
+
+var (
+	// ErrFrameTooLarge a message does not fit
+	// in a single frame of the format
+	ErrFrameTooLarge = fmt.Errorf(
+		"lenprefix: message too large for the length prefix",
+	)
+	// ErrBadLength a frame header holds a length
+	// the format can not have written
+	ErrBadLength = fmt.Errorf(
+		"lenprefix: frame length out of range",
+	)
+)
+
+// Format describes the length prefix of a frame
+type Format struct {
+	// Width the prefix is 1, 2, 4 or 8 bytes
+	Width int
+	// Order the byte order of the prefix,
+	// big endian when nil
+	Order binary.ByteOrder
+	// Inclusive the length counts the
+	// prefix as well as the payload
+	Inclusive bool
+	// Chunked messages are split into frames
+	// and end with a zero length frame, as qik
+	// does, otherwise every frame is a message
+	Chunked bool
+}
+
+var (
+	// Qik the format of the qik protocol
+	Qik = Format{
+		Width:   2,
+		Order:   binary.BigEndian,
+		Chunked: true,
+	}
+)
+
+// MaxFrame the largest payload a single
+// frame of the format can carry
+func (f Format) MaxFrame() int {
+	var L uint64 = 1<<63 - 1
+
+	if f.Width < 8 {
+		L = 1<<(8*uint(f.Width)) - 1
+	}
+
+	if f.Inclusive {
+		L -= uint64(f.Width)
+	}
+
+	if L > uint64(maxInt) {
+		return maxInt
+	}
+
+	return int(L)
+}
+
+// order the byte order, big endian by default
+func (f Format) order() binary.ByteOrder {
+	if f.Order == nil {
+		return binary.BigEndian
+	}
+
+	return f.Order
+}
+
+// put writes the header of a frame of L payload bytes
+func (f Format) put(b []byte, L int) {
+	x := uint64(L)
+
+	if f.Inclusive {
+		x += uint64(f.Width)
+	}
+
+	switch f.Width {
+	case 1:
+		b[0] = byte(x)
+	case 2:
+		f.order().PutUint16(b, uint16(x))
+	case 4:
+		f.order().PutUint32(b, uint32(x))
+	case 8:
+		f.order().PutUint64(b, x)
+	}
+}
+
+// length reads the payload length out of a header
+func (f Format) length(b []byte) (int, error) {
+	var x uint64
+
+	switch f.Width {
+	case 1:
+		x = uint64(b[0])
+	case 2:
+		x = uint64(f.order().Uint16(b))
+	case 4:
+		x = uint64(f.order().Uint32(b))
+	case 8:
+		x = f.order().Uint64(b)
+	}
+
+	if f.Inclusive {
+		if x < uint64(f.Width) {
+			return 0, ErrBadLength
+		}
+
+		x -= uint64(f.Width)
+	}
+
+	if x > uint64(f.MaxFrame()) {
+		return 0, ErrBadLength
+	}
+
+	return int(x), nil
+}
+
+// check panics on a width the format can not have
+func (f Format) check() {
+	switch f.Width {
+	case 1, 2, 4, 8:
+	default:
+		panic(fmt.Sprintf(
+			"lenprefix: width must be 1, 2, 4 or 8 bytes, not %v",
+			f.Width,
+		))
+	}
+}
+
+// Protocol frames messages with the Format
+type Protocol struct {
+	Format Format
+}
+
+// NewProtocol creates a protocol for the format,
+// it panics if the width is not 1, 2, 4 or 8
+func NewProtocol(f Format) *Protocol {
+	f.check()
+
+	p := Protocol{
+		Format: f,
+	}
+
+	return &p
+}
+
+// NewReader ...
+func (p *Protocol) NewReader(R io.Reader) io.Reader {
+	return NewReader(R, p.Format)
+}
+
+// NewWriter ...
+func (p *Protocol) NewWriter(W io.Writer) io.Writer {
+	return NewWriter(W, p.Format)
+}
+
+// Reader read messages using this Reader,
+// messages past Max bytes are skipped and
+// return proto.ErrMessageTooLarge
+type Reader struct {
+	R      io.Reader
+	Format Format
+	Buff   []byte
+	Count  int
+	Open   bool
+	Max    int
+	Size   int
+}
+
+// Writer encode messages using this Writer, a
+// format that is not chunked holds a message
+// in Buff until its end of message
+type Writer struct {
+	W      io.Writer
+	Format Format
+	Buff   []byte
+
+	flat flat.Buffer
+}
+
+// NewReader creates a new Reader that will
+// decode messages of the format from R
+func NewReader(R io.Reader, f Format) *Reader {
+	f.check()
+
+	r := Reader{
+		R:      R,
+		Format: f,
+		Buff:   make([]byte, f.Width),
+	}
+
+	return &r
+}
+
+// NewWriter creates a new Writer that will
+// encode messages of the format to W
+func NewWriter(W io.Writer, f Format) *Writer {
+	f.check()
+
+	w := Writer{
+		W:      W,
+		Format: f,
+	}
+
+	w.flat.Encode = w.message
+
+	return &w
+}
+
+// Read reads the payload of the current frame,
+// reading the next header once it runs out
+func (r *Reader) Read(b []byte) (int, error) {
+	if r.Count > 0 {
+		L := len(b)
+
+		if r.Count < L {
+			L = r.Count
+		}
+
+		n, err := r.R.Read(
+			b[:L],
+		)
+
+		r.Count -= n
+		r.Size += n
+
+		return n, err
+	}
+
+	// the frame was the whole message
+	if r.Open {
+		r.Open = false
+		r.Size = 0
+
+		return 0, proto.ErrEOM
+	}
+
+	L, err := r.header()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if L == 0 {
+		r.Size = 0
+
+		return 0, proto.ErrEOM
+	}
+
+	r.Count = L
+	r.Open = !r.Format.Chunked
+
+	if r.Max > 0 && r.Size+r.Count > r.Max {
+		return 0, r.skip()
+	}
+
+	return r.Read(b)
+}
+
+// SetMaxMessageSize ...
+func (r *Reader) SetMaxMessageSize(Max int) {
+	r.Max = Max
+}
+
+// header reads the length of the next frame
+func (r *Reader) header() (int, error) {
+	_, err := io.ReadFull(r.R, r.Buff)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return r.Format.length(r.Buff)
+}
+
+// skip drops the rest of a message past Max
+// frame by frame up to its end of message
+func (r *Reader) skip() error {
+	r.Open = false
+
+	for {
+		_, err := io.CopyN(ioutil.Discard, r.R, int64(r.Count))
+
+		r.Count = 0
+
+		if err != nil {
+			return err
+		}
+
+		if !r.Format.Chunked {
+			r.Size = 0
+
+			return proto.ErrMessageTooLarge
+		}
+
+		r.Count, err = r.header()
+
+		if err != nil {
+			return err
+		}
+
+		if r.Count == 0 {
+			r.Size = 0
+
+			return proto.ErrMessageTooLarge
+		}
+	}
+}
+
+// Write writes the bytes as frames of the format,
+// writing the empty buffer ends the message
+func (w *Writer) Write(b []byte) (int, error) {
+	if w.Format.Chunked {
+		_, err := w.flat.Write(w.W, w.frames(w.flat.Bytes(), b))
+
+		if err != nil {
+			return 0, err
+		}
+
+		return len(b), nil
+	}
+
+	if len(b) == 0 {
+		_, err := w.flat.Write(w.W, w.frame(w.flat.Bytes(), w.Buff))
+
+		w.Buff = w.Buff[:0]
+
+		return 0, err
+	}
+
+	if len(w.Buff)+len(b) > w.Format.MaxFrame() {
+		return 0, ErrFrameTooLarge
+	}
+
+	w.Buff = append(w.Buff, b...)
+
+	return len(b), nil
+}
+
+// WriteMessage writes the whole message
+// in a single write
+func (w *Writer) WriteMessage(b []byte) (int, error) {
+	return w.flat.WriteMessages(w.W, b)
+}
+
+// WriteMessages writes every message
+// in a single write
+func (w *Writer) WriteMessages(msgs ...[]byte) (int, error) {
+	return w.flat.WriteMessages(w.W, msgs...)
+}
+
+// message appends the whole message
+// and its end of message
+func (w *Writer) message(Flat []byte, m []byte) ([]byte, error) {
+	if !w.Format.Chunked {
+		if len(m) > w.Format.MaxFrame() {
+			return nil, ErrFrameTooLarge
+		}
+
+		return w.frame(Flat, m), nil
+	}
+
+	if len(m) > 0 {
+		Flat = w.frames(Flat, m)
+	}
+
+	return w.frames(Flat, nil), nil
+}
+
+// frame appends a header and the payload
+func (w *Writer) frame(Flat []byte, b []byte) []byte {
+	H := len(Flat)
+
+	for i := 0; i < w.Format.Width; i++ {
+		Flat = append(Flat, 0)
+	}
+
+	w.Format.put(Flat[H:], len(b))
+
+	return append(Flat, b...)
+}
+
+// frames appends the bytes split into frames,
+// the empty buffer appends the end of message
+func (w *Writer) frames(Flat []byte, b []byte) []byte {
+	if len(b) == 0 {
+		return w.frame(Flat, nil)
+	}
+
+	Max := w.Format.MaxFrame()
+
+	for len(b) > 0 {
+		L := len(b)
+
+		if L > Max {
+			L = Max
+		}
+
+		Flat = w.frame(Flat, b[:L])
+
+		b = b[L:]
+	}
+
+	return Flat
+}
@@ -0,0 +1,232 @@
+package lenprefix
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+func randomBytes(S int) ([]byte, error) {
+	BS := make([]byte, S)
+
+	_, err := rand.Read(BS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return BS, err
+}
+
+func TestFormats(t *testing.T) {
+	assert := assert.New(t)
+
+	Large, err := randomBytes(70 * 1000)
+
+	assert.Nil(
+		err,
+		"could not create random bytes",
+	)
+
+	Formats := []Format{
+		Qik,
+		{Width: 1, Chunked: true},
+		{Width: 1, Inclusive: true, Chunked: true},
+		{Width: 4},
+		{Width: 4, Order: binary.LittleEndian},
+		{Width: 4, Inclusive: true},
+		{Width: 8, Order: binary.LittleEndian, Chunked: true},
+		{Width: 8, Inclusive: true},
+	}
+
+	for _, f := range Formats {
+		B := bytes.NewBuffer(nil)
+		W, R := proto.Wrap(NewProtocol(f), B, B)
+
+		Messages := [][]byte{[]byte("hello"), nil, Large}
+
+		for _, m := range Messages {
+			// writing the empty buffer ends the message
+			if len(m) > 0 {
+				W.Write(m[:len(m)/2])
+				W.Write(m[len(m)/2:])
+			}
+
+			W.Write(nil)
+		}
+
+		proto.WriteMessages(W, Messages...)
+
+		for i := 0; i < 2; i++ {
+			for _, m := range Messages {
+				Received, err := proto.ReadMessage(R)
+
+				assert.Nil(
+					err,
+					"bytes not read",
+				)
+
+				assert.Equal(
+					len(m),
+					len(Received),
+					"lengths match",
+				)
+
+				assert.True(
+					bytes.Equal(m, Received),
+					"bytes match",
+				)
+			}
+		}
+
+		_, err := R.Read(make([]byte, 16))
+
+		assert.Equal(
+			io.EOF,
+			err,
+			"the stream is over",
+		)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	Cases := []struct {
+		F Format
+		E []byte
+	}{
+		{Format{Width: 2}, []byte{0, 2, 'h', 'i'}},
+		{Format{Width: 2, Order: binary.LittleEndian}, []byte{2, 0, 'h', 'i'}},
+		{Format{Width: 2, Inclusive: true}, []byte{0, 4, 'h', 'i'}},
+		{Format{Width: 1, Chunked: true}, []byte{2, 'h', 'i', 0}},
+		{Format{Width: 4, Inclusive: true, Chunked: true}, []byte{0, 0, 0, 6, 'h', 'i', 0, 0, 0, 4}},
+	}
+
+	for _, c := range Cases {
+		B := bytes.NewBuffer(nil)
+
+		proto.WriteMessage(NewWriter(B, c.F), []byte("hi"))
+
+		assert.Equal(
+			c.E,
+			B.Bytes(),
+			"the frame matches the format",
+		)
+	}
+
+	_, err := NewReader(bytes.NewReader([]byte{0, 1}), Format{Width: 2, Inclusive: true}).Read(make([]byte, 4))
+
+	assert.Equal(
+		ErrBadLength,
+		err,
+		"an inclusive length can not be shorter than its prefix",
+	)
+
+	_, err = NewWriter(bytes.NewBuffer(nil), Format{Width: 1}).Write(make([]byte, 256))
+
+	assert.Equal(
+		ErrFrameTooLarge,
+		err,
+		"the message does not fit in a frame",
+	)
+
+	assert.Panics(
+		func() {
+			NewProtocol(Format{Width: 3})
+		},
+		"the width must be 1, 2, 4 or 8",
+	)
+}
+
+func TestQikCompatible(t *testing.T) {
+	assert := assert.New(t)
+
+	Large, err := randomBytes(200 * 1000)
+
+	assert.Nil(
+		err,
+		"could not create random bytes",
+	)
+
+	Messages := [][]byte{[]byte("hello"), nil, Large}
+
+	A := bytes.NewBuffer(nil)
+	B := bytes.NewBuffer(nil)
+
+	QW := qik.NewWriter(A)
+	LW := NewWriter(B, Qik)
+
+	for _, m := range Messages {
+		for _, W := range []io.Writer{QW, LW} {
+			if len(m) > 0 {
+				W.Write(m)
+			}
+
+			W.Write(nil)
+		}
+	}
+
+	assert.Equal(
+		A.Bytes(),
+		B.Bytes(),
+		"the Qik preset encodes exactly as qik does",
+	)
+
+	// qik reads the preset and the preset reads qik
+	for _, R := range []io.Reader{qik.NewReader(B), NewReader(A, Qik)} {
+		for _, m := range Messages {
+			Received, err := proto.ReadMessage(R)
+
+			assert.Nil(
+				err,
+				"bytes not read",
+			)
+
+			assert.True(
+				bytes.Equal(m, Received),
+				"bytes match",
+			)
+		}
+	}
+
+	C := bytes.NewBuffer(nil)
+	D := bytes.NewBuffer(nil)
+
+	proto.WriteMessages(qik.NewWriter(C), Messages...)
+	proto.WriteMessages(NewWriter(D, Qik), Messages...)
+
+	assert.Equal(
+		C.Bytes(),
+		D.Bytes(),
+		"batches encode exactly as qik does",
+	)
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, f := range []Format{Qik, {Width: 4}} {
+		B := bytes.NewBuffer(nil)
+		W, R := proto.Wrap(NewProtocol(f), B, B)
+
+		proto.WriteMessages(W, []byte("small"), make([]byte, 200*1000), []byte("again"))
+
+		R = proto.LimitMessages(R, 100)
+
+		for _, E := range []error{nil, proto.ErrMessageTooLarge, nil} {
+			_, err := proto.ReadMessage(R)
+
+			assert.Equal(
+				E,
+				err,
+				"messages past the max are skipped",
+			)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package proto
+
+import (
+	"io"
+)
+
+// SizeLimiter is implemented by message readers
+// that enforce a max message size themselves. Past
+// the max they return ErrMessageTooLarge and skip
+// ahead to the start of the next message
+type SizeLimiter interface {
+	SetMaxMessageSize(int)
+}
+
+// LimitedReader enforces a max message size over
+// any message reader, a message past the max is
+// read up to its end and dropped
+type LimitedReader struct {
+	R    io.Reader
+	Max  int
+	Size int
+	Buff []byte
+}
+
+// LimitMessages limits the messages read off of R
+// to Max bytes, zero means no limit. Readers that
+// are a SizeLimiter enforce the max themselves,
+// others are wrapped in a LimitedReader
+func LimitMessages(R io.Reader, Max int) io.Reader {
+	if l, ok := R.(SizeLimiter); ok {
+		l.SetMaxMessageSize(Max)
+
+		return R
+	}
+
+	r := LimitedReader{
+		R:   R,
+		Max: Max,
+	}
+
+	return &r
+}
+
+// ReadMessageMax reads a message like ReadMessage but
+// returns ErrMessageTooLarge past Max bytes
+func ReadMessageMax(R io.Reader, Max int) ([]byte, error) {
+	r := LimitedReader{
+		R:   R,
+		Max: Max,
+	}
+
+	return ReadMessage(&r)
+}
+
+// SetMaxMessageSize ...
+func (r *LimitedReader) SetMaxMessageSize(Max int) {
+	r.Max = Max
+}
+
+// Read reads from the message reader, it returns
+// ErrMessageTooLarge once the message is past Max
+func (r *LimitedReader) Read(b []byte) (int, error) {
+	// read at most one byte past the max
+	if r.Max > 0 && len(b) > r.Max-r.Size+1 {
+		b = b[:r.Max-r.Size+1]
+	}
+
+	n, err := r.R.Read(b)
+
+	r.Size += n
+
+	if r.Max > 0 && r.Size > r.Max {
+		r.Size = 0
+
+		if err == nil {
+			r.skip()
+		}
+
+		return 0, ErrMessageTooLarge
+	}
+
+	if err == ErrEOM {
+		r.Size = 0
+	}
+
+	return n, err
+}
+
+// skip reads up to the end of the message
+func (r *LimitedReader) skip() {
+	if r.Buff == nil {
+		r.Buff = make([]byte, 512)
+	}
+
+	for {
+		_, err := r.R.Read(r.Buff)
+
+		if err != nil {
+			return
+		}
+	}
+}
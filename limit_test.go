@@ -0,0 +1,124 @@
+package proto_test
+
+import (
+	"bytes"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/crc"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestLimitedReader(t *testing.T) {
+	assert := assert.New(t)
+
+	p := crc.NewProtocol(qik.NewProtocol())
+
+	B := bytes.NewBuffer(nil)
+	W, R := proto.Wrap(p, B, B)
+
+	proto.WriteMessage(W, bytes.Repeat([]byte("large"), 1000))
+	proto.WriteMessage(W, []byte("small"))
+
+	R = proto.LimitMessages(R, 100)
+
+	assert.IsType(
+		&proto.LimitedReader{},
+		R,
+		"readers without a limit of their own are wrapped",
+	)
+
+	_, err := proto.ReadMessage(R)
+
+	assert.Equal(
+		proto.ErrMessageTooLarge,
+		err,
+		"the message is past the max",
+	)
+
+	Received, err := proto.ReadMessage(R)
+
+	assert.Nil(
+		err,
+		"the reader skipped to the next message",
+	)
+
+	assert.Equal(
+		"small",
+		string(Received),
+		"bytes match",
+	)
+}
+
+func TestReadMessageMax(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+	W := qik.NewWriter(B)
+
+	proto.WriteMessage(W, make([]byte, 101))
+	proto.WriteMessage(W, make([]byte, 100))
+
+	R := qik.NewReader(B)
+
+	_, err := proto.ReadMessageMax(R, 100)
+
+	assert.Equal(
+		proto.ErrMessageTooLarge,
+		err,
+		"the message is past the max",
+	)
+
+	Received, err := proto.ReadMessageMax(R, 100)
+
+	assert.Nil(
+		err,
+		"a message of exactly Max bytes is read",
+	)
+
+	assert.Len(
+		Received,
+		100,
+		"bytes match",
+	)
+}
+
+func TestConnMaxMessageSize(t *testing.T) {
+	assert := assert.New(t)
+
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	A := proto.WrapConn(qik.NewProtocol(), a)
+	B := proto.WrapConn(qik.NewProtocol(), b)
+
+	B.(*proto.Conn).SetMaxMessageSize(10)
+
+	go func() {
+		proto.WriteMessage(A, make([]byte, 11))
+		proto.WriteMessage(A, []byte("ok"))
+	}()
+
+	_, err := proto.ReadMessage(B)
+
+	assert.Equal(
+		proto.ErrMessageTooLarge,
+		err,
+		"the message is past the max",
+	)
+
+	Received, err := proto.ReadMessage(B)
+
+	assert.Nil(
+		err,
+		"the next message is read",
+	)
+
+	assert.Equal(
+		"ok",
+		string(Received),
+		"bytes match",
+	)
+}
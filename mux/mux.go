@@ -0,0 +1,483 @@
+package mux
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/johnmcconnell/proto"
+	"io"
+	"sync"
+)
+
+const (
+	// HeaderSize the count of bytes in front of
+	// every frame, a type byte and a stream ID
+	HeaderSize = 5
+	// DefaultWindow the count of bytes a stream may
+	// have in flight before the reader catches up
+	DefaultWindow = 256 * 1024
+	// MaxData the largest data frame, so one busy
+	// stream does not hold up the others
+	MaxData = 32 * 1024
+	// AcceptBacklog the count of opened streams
+	// waiting for Accept before new ones are reset
+	AcceptBacklog = 64
+
+	// FrameOpen opens a new stream
+	FrameOpen = 0
+	// FrameData carries stream bytes
+	FrameData = 1
+	// FrameWindow grants the sender more window,
+	// the payload is a 4 byte increment
+	FrameWindow = 2
+	// FrameClose the sender will write no more
+	FrameClose = 3
+	// FrameReset aborts the stream in both directions
+	FrameReset = 4
+)
+
+var (
+	// ErrSessionClosed is returned once the session
+	// or its connection is closed
+	ErrSessionClosed = fmt.Errorf(
+		"mux: session closed",
+	)
+	// ErrStreamClosed is returned writing to a
+	// stream after Close
+	ErrStreamClosed = fmt.Errorf(
+		"mux: stream closed",
+	)
+	// ErrStreamReset is returned after the peer
+	// reset the stream
+	ErrStreamReset = fmt.Errorf(
+		"mux: stream reset",
+	)
+)
+
+// Session carries many streams over one protocol
+// wrapped connection, every frame is one message
+type Session struct {
+	C io.ReadWriteCloser
+
+	window  int
+	wmu     sync.Mutex
+	mu      sync.Mutex
+	streams map[uint32]*Stream
+	next    uint32
+	accept  chan *Stream
+	done    chan struct{}
+	err     error
+}
+
+// Stream is a single logical channel of a Session
+type Stream struct {
+	ID uint32
+
+	s            *Session
+	mu           sync.Mutex
+	cond         *sync.Cond
+	buff         []byte
+	consumed     int
+	window       int
+	localClosed  bool
+	remoteClosed bool
+	err          error
+}
+
+// Client creates the dialing side of a session,
+// it opens odd stream IDs
+func Client(C io.ReadWriteCloser) *Session {
+	return NewSession(C, true)
+}
+
+// Server creates the listening side of a session,
+// it opens even stream IDs
+func Server(C io.ReadWriteCloser) *Session {
+	return NewSession(C, false)
+}
+
+// NewSession starts reading frames off of the
+// connection, it should already be wrapped with
+// a protocol such as proto.WrapConn
+func NewSession(C io.ReadWriteCloser, client bool) *Session {
+	return NewSessionWindow(C, client, DefaultWindow)
+}
+
+// NewSessionWindow is NewSession with the receive
+// window of every stream, both peers must use
+// the same Window
+func NewSessionWindow(C io.ReadWriteCloser, client bool, Window int) *Session {
+	s := Session{
+		C:       C,
+		window:  Window,
+		streams: make(map[uint32]*Stream),
+		next:    2,
+		accept:  make(chan *Stream, AcceptBacklog),
+		done:    make(chan struct{}),
+	}
+
+	if client {
+		s.next = 1
+	}
+
+	go s.read()
+
+	return &s
+}
+
+// Window the receive window of every stream
+func (s *Session) Window() int {
+	return s.window
+}
+
+// Open opens a new stream to the peer
+func (s *Session) Open() (*Stream, error) {
+	s.mu.Lock()
+
+	if s.err != nil {
+		s.mu.Unlock()
+
+		return nil, s.err
+	}
+
+	ID := s.next
+	s.next += 2
+
+	S := s.newStream(ID)
+
+	s.mu.Unlock()
+
+	err := s.write(FrameOpen, ID, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return S, nil
+}
+
+// Accept waits for the peer to open a stream
+func (s *Session) Accept() (*Stream, error) {
+	select {
+	case S := <-s.accept:
+		return S, nil
+
+	case <-s.done:
+		return nil, ErrSessionClosed
+	}
+}
+
+// Close closes the connection and every stream
+func (s *Session) Close() error {
+	err := s.C.Close()
+
+	s.teardown(ErrSessionClosed)
+
+	return err
+}
+
+// newStream s.mu must be held
+func (s *Session) newStream(ID uint32) *Stream {
+	S := Stream{
+		ID:     ID,
+		s:      s,
+		window: s.window,
+	}
+
+	S.cond = sync.NewCond(&S.mu)
+
+	s.streams[ID] = &S
+
+	return &S
+}
+
+// read hands every frame to its stream
+func (s *Session) read() {
+	for {
+		m, err := proto.ReadWholeMessage(s.C)
+
+		if err == io.EOF {
+			err = ErrSessionClosed
+		}
+
+		// a frame cut short fails with
+		// io.ErrUnexpectedEOF
+		if err != nil {
+			s.teardown(err)
+
+			return
+		}
+
+		if len(m) < HeaderSize {
+			s.teardown(ErrSessionClosed)
+
+			return
+		}
+
+		s.handle(m[0], binary.BigEndian.Uint32(m[1:]), m[HeaderSize:])
+	}
+}
+
+// handle a single frame
+func (s *Session) handle(Type byte, ID uint32, B []byte) {
+	if Type == FrameOpen {
+		s.mu.Lock()
+
+		_, exists := s.streams[ID]
+
+		if exists || s.err != nil {
+			s.mu.Unlock()
+
+			return
+		}
+
+		S := s.newStream(ID)
+
+		s.mu.Unlock()
+
+		// the reset is written off of the read
+		// loop, it must never wait on the peer
+		select {
+		case s.accept <- S:
+		default:
+			go S.Reset()
+		}
+
+		return
+	}
+
+	s.mu.Lock()
+	S, ok := s.streams[ID]
+	s.mu.Unlock()
+
+	// the stream was closed on this side
+	if !ok {
+		return
+	}
+
+	S.mu.Lock()
+	defer S.mu.Unlock()
+
+	switch Type {
+	case FrameData:
+		if len(S.buff)+len(B) > s.window {
+			S.err = ErrStreamReset
+			s.remove(ID)
+
+			go s.write(FrameReset, ID, nil)
+
+			break
+		}
+
+		S.buff = append(S.buff, B...)
+
+	case FrameWindow:
+		if len(B) == 4 {
+			S.window += int(binary.BigEndian.Uint32(B))
+		}
+
+	case FrameClose:
+		S.remoteClosed = true
+
+		if S.localClosed {
+			s.remove(ID)
+		}
+
+	case FrameReset:
+		S.err = ErrStreamReset
+		s.remove(ID)
+	}
+
+	S.cond.Broadcast()
+}
+
+// remove forgets a stream
+func (s *Session) remove(ID uint32) {
+	s.mu.Lock()
+	delete(s.streams, ID)
+	s.mu.Unlock()
+}
+
+// teardown fails every stream
+func (s *Session) teardown(err error) {
+	s.mu.Lock()
+
+	if s.err != nil {
+		s.mu.Unlock()
+
+		return
+	}
+
+	s.err = err
+	close(s.done)
+
+	streams := s.streams
+	s.streams = make(map[uint32]*Stream)
+
+	s.mu.Unlock()
+
+	for _, S := range streams {
+		S.mu.Lock()
+
+		if S.err == nil {
+			S.err = err
+		}
+
+		S.cond.Broadcast()
+		S.mu.Unlock()
+	}
+}
+
+// write sends a single frame
+func (s *Session) write(Type byte, ID uint32, B []byte) error {
+	M := make([]byte, HeaderSize+len(B))
+
+	M[0] = Type
+	binary.BigEndian.PutUint32(M[1:], ID)
+	copy(M[HeaderSize:], B)
+
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	_, err := proto.WriteMessage(s.C, M)
+
+	if err != nil {
+		s.teardown(err)
+	}
+
+	return err
+}
+
+// Read reads bytes the peer wrote to the stream,
+// it returns io.EOF after the peer closed it
+func (S *Stream) Read(b []byte) (int, error) {
+	S.mu.Lock()
+
+	for len(S.buff) == 0 && !S.remoteClosed && S.err == nil {
+		S.cond.Wait()
+	}
+
+	if len(S.buff) == 0 {
+		defer S.mu.Unlock()
+
+		if S.err != nil {
+			return 0, S.err
+		}
+
+		return 0, io.EOF
+	}
+
+	n := copy(b, S.buff)
+	S.buff = S.buff[n:]
+	S.consumed += n
+
+	var inc int
+
+	// grant the window back once half is used
+	if S.consumed >= S.s.window/2 {
+		inc = S.consumed
+		S.consumed = 0
+	}
+
+	S.mu.Unlock()
+
+	if inc > 0 {
+		B := make([]byte, 4)
+		binary.BigEndian.PutUint32(B, uint32(inc))
+
+		S.s.write(FrameWindow, S.ID, B)
+	}
+
+	return n, nil
+}
+
+// Write writes bytes to the stream, blocking
+// while the peer's window is full
+func (S *Stream) Write(b []byte) (int, error) {
+	s := 0
+
+	for s < len(b) {
+		S.mu.Lock()
+
+		for S.window == 0 && !S.localClosed && S.err == nil {
+			S.cond.Wait()
+		}
+
+		if S.err != nil {
+			defer S.mu.Unlock()
+
+			return s, S.err
+		}
+
+		if S.localClosed {
+			defer S.mu.Unlock()
+
+			return s, ErrStreamClosed
+		}
+
+		L := len(b) - s
+
+		if L > S.window {
+			L = S.window
+		}
+
+		if L > MaxData {
+			L = MaxData
+		}
+
+		S.window -= L
+
+		S.mu.Unlock()
+
+		err := S.s.write(FrameData, S.ID, b[s:s+L])
+
+		if err != nil {
+			return s, err
+		}
+
+		s += L
+	}
+
+	return s, nil
+}
+
+// Close closes the stream for writing, the peer
+// reads io.EOF once it has read what was written
+func (S *Stream) Close() error {
+	S.mu.Lock()
+
+	if S.localClosed || S.err != nil {
+		S.mu.Unlock()
+
+		return nil
+	}
+
+	S.localClosed = true
+
+	if S.remoteClosed {
+		S.s.remove(S.ID)
+	}
+
+	S.cond.Broadcast()
+	S.mu.Unlock()
+
+	return S.s.write(FrameClose, S.ID, nil)
+}
+
+// Reset aborts the stream in both directions
+func (S *Stream) Reset() error {
+	S.mu.Lock()
+
+	if S.err != nil {
+		S.mu.Unlock()
+
+		return nil
+	}
+
+	S.err = ErrStreamReset
+	S.s.remove(S.ID)
+
+	S.cond.Broadcast()
+	S.mu.Unlock()
+
+	return S.s.write(FrameReset, S.ID, nil)
+}
@@ -0,0 +1,337 @@
+package mux
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/johnmcconnell/proto/slim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func randomBytes(S int) ([]byte, error) {
+	BS := make([]byte, S)
+
+	_, err := rand.Read(BS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return BS, err
+}
+
+func pipe(p proto.Protocol) (*Session, *Session) {
+	return pipeWindow(p, DefaultWindow)
+}
+
+func pipeWindow(p proto.Protocol, Window int) (*Session, *Session) {
+	a, b := net.Pipe()
+
+	A := NewSessionWindow(proto.WrapConn(p, a), true, Window)
+	B := NewSessionWindow(proto.WrapConn(p, b), false, Window)
+
+	return A, B
+}
+
+func TestStreams(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	for _, p := range []proto.Protocol{qik.NewProtocol(), slim.NewProtocol()} {
+		A, B := pipe(p)
+
+		// echo every accepted stream
+		go func() {
+			for {
+				S, err := B.Accept()
+
+				if err != nil {
+					return
+				}
+
+				go func() {
+					io.Copy(S, S)
+					S.Close()
+				}()
+			}
+		}()
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				Sent, err := randomBytes(100 * 1000)
+
+				require.Nil(
+					err,
+					"could not create random bytes",
+				)
+
+				S, err := A.Open()
+
+				require.Nil(
+					err,
+					"could not open a stream",
+				)
+
+				go func() {
+					S.Write(Sent)
+					S.Close()
+				}()
+
+				Received, err := ioutil.ReadAll(S)
+
+				assert.Nil(
+					err,
+					"the stream ends with EOF",
+				)
+
+				assert.True(
+					bytes.Equal(Sent, Received),
+					"bytes match",
+				)
+			}()
+		}
+
+		wg.Wait()
+
+		A.Close()
+		B.Close()
+	}
+}
+
+func TestFlowControl(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	A, B := pipeWindow(qik.NewProtocol(), 1024)
+	defer A.Close()
+	defer B.Close()
+
+	S, err := A.Open()
+
+	require.Nil(
+		err,
+		"could not open a stream",
+	)
+
+	R, err := B.Accept()
+
+	require.Nil(
+		err,
+		"could not accept a stream",
+	)
+
+	written := make(chan int)
+
+	go func() {
+		n, _ := S.Write(make([]byte, 4096))
+		written <- n
+	}()
+
+	select {
+	case <-written:
+		t.Fatal("the write did not wait for the window")
+
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	n, err := io.ReadFull(R, make([]byte, 4096))
+
+	assert.Nil(
+		err,
+		"there is no error",
+	)
+
+	assert.Equal(
+		4096,
+		n,
+		"all the bytes were read",
+	)
+
+	assert.Equal(
+		4096,
+		<-written,
+		"all the bytes were written",
+	)
+}
+
+func TestAcceptBacklog(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	A, B := pipe(qik.NewProtocol())
+	defer A.Close()
+	defer B.Close()
+
+	var S *Stream
+
+	// nobody accepts, the last one is reset
+	for i := 0; i <= AcceptBacklog; i++ {
+		var err error
+
+		S, err = A.Open()
+
+		require.Nil(
+			err,
+			"could not open a stream",
+		)
+	}
+
+	_, err := S.Read(make([]byte, 16))
+
+	assert.Equal(
+		ErrStreamReset,
+		err,
+		"streams past the backlog are reset",
+	)
+
+	R, err := B.Accept()
+
+	require.Nil(
+		err,
+		"could not accept a stream",
+	)
+
+	assert.Equal(
+		uint32(1),
+		R.ID,
+		"the backlog is kept",
+	)
+}
+
+func TestTruncatedFrame(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	a, b := net.Pipe()
+
+	A := Client(proto.WrapConn(qik.NewProtocol(), a))
+	defer A.Close()
+
+	Accepted := make(chan struct{})
+
+	// the peer opens a stream and drops the
+	// connection in the middle of a data frame
+	go func() {
+		B := bytes.NewBuffer(nil)
+		W := qik.NewWriter(B)
+
+		proto.WriteMessage(W, []byte{FrameOpen, 0, 0, 0, 2})
+		b.Write(B.Bytes())
+
+		B.Reset()
+		proto.WriteMessage(W, append([]byte{FrameData, 0, 0, 0, 2}, bytes.Repeat([]byte("partial."), 10)...))
+
+		<-Accepted
+
+		b.Write(B.Bytes()[:20])
+		b.Close()
+	}()
+
+	S, err := A.Accept()
+
+	close(Accepted)
+
+	require.Nil(
+		err,
+		"could not accept a stream",
+	)
+
+	n, err := S.Read(make([]byte, 100))
+
+	assert.Equal(
+		0,
+		n,
+		"no bytes of the cut frame are read",
+	)
+
+	assert.Equal(
+		io.ErrUnexpectedEOF,
+		err,
+		"a frame cut short fails the session",
+	)
+}
+
+func TestSessionClose(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	A, B := pipe(qik.NewProtocol())
+
+	S, err := A.Open()
+
+	require.Nil(
+		err,
+		"could not open a stream",
+	)
+
+	B.Close()
+
+	_, err = S.Read(make([]byte, 16))
+
+	assert.NotNil(
+		err,
+		"reads fail once the session is closed",
+	)
+
+	_, err = B.Accept()
+
+	assert.Equal(
+		ErrSessionClosed,
+		err,
+		"accept fails once the session is closed",
+	)
+
+	_, err = A.Open()
+
+	assert.NotNil(
+		err,
+		"opening fails once the session is closed",
+	)
+}
+
+func TestReset(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	A, B := pipe(qik.NewProtocol())
+	defer A.Close()
+	defer B.Close()
+
+	S, err := A.Open()
+
+	require.Nil(
+		err,
+		"could not open a stream",
+	)
+
+	R, err := B.Accept()
+
+	require.Nil(
+		err,
+		"could not accept a stream",
+	)
+
+	R.Reset()
+
+	_, err = S.Read(make([]byte, 16))
+
+	assert.Equal(
+		ErrStreamReset,
+		err,
+		"the peer reset the stream",
+	)
+}
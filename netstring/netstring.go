@@ -0,0 +1,319 @@
+package netstring
+
+import (
+	"fmt"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/internal/flat"
+	"io"
+	"strconv"
+)
+
+const (
+	// BufferSize the size of the read buffer
+	BufferSize = 512
+
+	maxInt = int(^uint(0) >> 1)
+)
+
+var (
+	// ErrMissingLength a netstring starts
+	// with a colon instead of its length
+	ErrMissingLength = fmt.Errorf(
+		"netstring: missing length",
+	)
+	// ErrLeadingZero a length other than
+	// zero starts with a zero
+	ErrLeadingZero = fmt.Errorf(
+		"netstring: length has a leading zero",
+	)
+	// ErrLengthOverflow a length does
+	// not fit in an int
+	ErrLengthOverflow = fmt.Errorf(
+		"netstring: length overflows an int",
+	)
+	// ErrMissingComma the data is not
+	// followed by a comma
+	ErrMissingComma = fmt.Errorf(
+		"netstring: missing trailing comma",
+	)
+)
+
+// Protocol frames every message as a netstring,
+// "<len>:<data>,". A Max of zero means no limit
+type Protocol struct {
+	Max int
+}
+
+// NewReader ...
+func (p *Protocol) NewReader(R io.Reader) io.Reader {
+	r := NewReader(R)
+	r.Max = p.Max
+
+	return r
+}
+
+// NewWriter ...
+func (p *Protocol) NewWriter(W io.Writer) io.Writer {
+	return NewWriter(W)
+}
+
+// NewProtocol ...
+func NewProtocol(Max int) *Protocol {
+	p := Protocol{
+		Max: Max,
+	}
+
+	return &p
+}
+
+func init() {
+	proto.Register("netstring", func() proto.Protocol {
+		return NewProtocol(0)
+	})
+}
+
+// Reader read messages using this Reader. A
+// malformed netstring breaks the stream, every
+// read after it returns the same error. Netstrings
+// longer than Max are skipped and return
+// proto.ErrMessageTooLarge
+type Reader struct {
+	R       io.Reader
+	Buff    []byte
+	Pending []byte
+	Err     error
+	Broken  error
+	Length  int
+	Digits  int
+	Count   int
+	Open    bool
+	Skip    bool
+	Max     int
+}
+
+// Writer encode messages using this Writer, a
+// message is held in Buff until its end of
+// message since its length comes first
+type Writer struct {
+	W    io.Writer
+	Buff []byte
+
+	flat flat.Buffer
+}
+
+// NewReader creates a new Reader that
+// will decode messages from an io.Reader
+func NewReader(R io.Reader) *Reader {
+	r := Reader{
+		R:    R,
+		Buff: make([]byte, BufferSize),
+	}
+
+	return &r
+}
+
+// NewWriter creates a new Writer that
+// will encode messages to an io.Writer
+func NewWriter(W io.Writer) *Writer {
+	w := Writer{
+		W: W,
+	}
+
+	w.flat.Encode = message
+
+	return &w
+}
+
+// Read reads the data of the netstring, it
+// returns proto.ErrEOM at the trailing comma
+func (r *Reader) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	for {
+		if r.Broken != nil {
+			return 0, r.Broken
+		}
+
+		if len(r.Pending) == 0 {
+			err := r.fill()
+
+			if err == io.EOF && (r.Digits > 0 || r.Open) {
+				return 0, io.ErrUnexpectedEOF
+			}
+
+			if err != nil {
+				return 0, err
+			}
+
+			continue
+		}
+
+		switch {
+		case r.Count > 0:
+			L := r.Count
+
+			if L > len(r.Pending) {
+				L = len(r.Pending)
+			}
+
+			if r.Skip {
+				r.Pending = r.Pending[L:]
+				r.Count -= L
+
+				continue
+			}
+
+			if L > len(b) {
+				L = len(b)
+			}
+
+			n := copy(b, r.Pending[:L])
+
+			r.Pending = r.Pending[n:]
+			r.Count -= n
+
+			return n, nil
+
+		case r.Open:
+			c := r.Pending[0]
+
+			r.Pending = r.Pending[1:]
+			r.Open = false
+
+			if c != ',' {
+				r.Broken = ErrMissingComma
+
+				return 0, r.Broken
+			}
+
+			if r.Skip {
+				r.Skip = false
+
+				return 0, proto.ErrMessageTooLarge
+			}
+
+			return 0, proto.ErrEOM
+
+		default:
+			r.Broken = r.header()
+		}
+	}
+}
+
+// SetMaxMessageSize ...
+func (r *Reader) SetMaxMessageSize(Max int) {
+	r.Max = Max
+}
+
+// fill reads more pending bytes, an error
+// that came with bytes waits until they
+// are used up
+func (r *Reader) fill() error {
+	if r.Err != nil {
+		err := r.Err
+		r.Err = nil
+
+		return err
+	}
+
+	n, err := r.R.Read(r.Buff)
+
+	r.Pending = r.Buff[:n]
+
+	if n > 0 {
+		r.Err = err
+
+		return nil
+	}
+
+	return err
+}
+
+// header reads the pending length digits, the
+// netstring opens at the colon
+func (r *Reader) header() error {
+	for len(r.Pending) > 0 {
+		c := r.Pending[0]
+
+		r.Pending = r.Pending[1:]
+
+		switch {
+		case c == ':':
+			if r.Digits == 0 {
+				return ErrMissingLength
+			}
+
+			r.Count = r.Length
+			r.Length = 0
+			r.Digits = 0
+			r.Open = true
+			r.Skip = r.Max > 0 && r.Count > r.Max
+
+			return nil
+
+		case '0' <= c && c <= '9':
+			if r.Digits > 0 && r.Length == 0 {
+				return ErrLeadingZero
+			}
+
+			if r.Length > (maxInt-9)/10 {
+				return ErrLengthOverflow
+			}
+
+			r.Length = r.Length*10 + int(c-'0')
+			r.Digits++
+
+		default:
+			return fmt.Errorf(
+				"netstring: unexpected %q in the length",
+				c,
+			)
+		}
+	}
+
+	return nil
+}
+
+// Write writes the bytes to the netstring being
+// built, writing the empty buffer writes it out
+func (w *Writer) Write(b []byte) (int, error) {
+	if len(b) > 0 {
+		w.Buff = append(w.Buff, b...)
+
+		return len(b), nil
+	}
+
+	_, err := w.flat.Write(w.W, frame(w.flat.Bytes(), w.Buff))
+
+	w.Buff = w.Buff[:0]
+
+	return 0, err
+}
+
+// WriteMessage writes the whole message
+// in a single write
+func (w *Writer) WriteMessage(b []byte) (int, error) {
+	return w.flat.WriteMessages(w.W, b)
+}
+
+// WriteMessages writes every message
+// in a single write
+func (w *Writer) WriteMessages(msgs ...[]byte) (int, error) {
+	return w.flat.WriteMessages(w.W, msgs...)
+}
+
+// message appends the message as a netstring
+func message(Flat []byte, m []byte) ([]byte, error) {
+	return frame(Flat, m), nil
+}
+
+// frame appends b as a netstring
+func frame(Flat []byte, b []byte) []byte {
+	Flat = strconv.AppendInt(Flat, int64(len(b)), 10)
+	Flat = append(Flat, ':')
+	Flat = append(Flat, b...)
+
+	return append(Flat, ',')
+}
@@ -0,0 +1,170 @@
+package netstring
+
+import (
+	"bytes"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+	W := NewWriter(B)
+
+	W.Write([]byte("hel"))
+	W.Write([]byte("lo"))
+	W.Write(nil)
+
+	proto.WriteMessages(W, nil, []byte("world"))
+
+	assert.Equal(
+		"5:hello,0:,5:world,",
+		B.String(),
+		"bytes are netstrings",
+	)
+}
+
+func TestDecoding(t *testing.T) {
+	assert := assert.New(t)
+
+	In := "5:hello,0:,12:hello world!,"
+
+	// one byte at a time splits every part
+	for _, R := range []io.Reader{strings.NewReader(In), iotest.OneByteReader(strings.NewReader(In))} {
+		D := NewReader(R)
+
+		for _, m := range []string{"hello", "", "hello world!"} {
+			Received, err := proto.ReadMessage(D)
+
+			assert.Nil(
+				err,
+				"bytes not read",
+			)
+
+			assert.Equal(
+				m,
+				string(Received),
+				"bytes match",
+			)
+		}
+
+		_, err := D.Read(make([]byte, 16))
+
+		assert.Equal(
+			io.EOF,
+			err,
+			"the stream is over",
+		)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	assert := assert.New(t)
+
+	Cases := map[string]error{
+		":hello,":                 ErrMissingLength,
+		"05:hello,":               ErrLeadingZero,
+		"5:hello;":                ErrMissingComma,
+		"99999999999999999999:x,": ErrLengthOverflow,
+		"5:hel":                   io.ErrUnexpectedEOF,
+		"12":                      io.ErrUnexpectedEOF,
+	}
+
+	for In, E := range Cases {
+		_, err := proto.ReadMessage(NewReader(strings.NewReader(In)))
+
+		assert.Equal(
+			E,
+			err,
+			"the netstring is malformed: "+In,
+		)
+	}
+
+	D := NewReader(strings.NewReader("5x:hello,"))
+
+	_, err := proto.ReadMessage(D)
+
+	assert.EqualError(
+		err,
+		`netstring: unexpected 'x' in the length`,
+		"the length has a bad byte",
+	)
+
+	_, err = D.Read(make([]byte, 16))
+
+	assert.EqualError(
+		err,
+		`netstring: unexpected 'x' in the length`,
+		"the stream stays broken",
+	)
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	assert := assert.New(t)
+
+	D := NewProtocol(5).NewReader(strings.NewReader("5:small,12:hello world!,5:again,"))
+
+	for _, E := range []error{nil, proto.ErrMessageTooLarge, nil} {
+		_, err := proto.ReadMessage(D)
+
+		assert.Equal(
+			E,
+			err,
+			"netstrings past the max are skipped",
+		)
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	assert := assert.New(t)
+
+	p, ok := proto.Lookup("netstring")
+
+	assert.True(
+		ok,
+		"netstring registers itself",
+	)
+
+	Out := bytes.NewBuffer(nil)
+
+	n, err := proto.CopyMessages(
+		qik.NewWriter(Out),
+		p.NewReader(strings.NewReader("5:hello,5:world,")),
+		make([]byte, 16),
+		2,
+	)
+
+	assert.Nil(
+		err,
+		"messages not copied",
+	)
+
+	assert.Equal(
+		2,
+		n,
+		"both messages were copied",
+	)
+
+	R := qik.NewReader(Out)
+
+	for _, m := range []string{"hello", "world"} {
+		Received, err := proto.ReadMessage(R)
+
+		assert.Nil(
+			err,
+			"bytes not read",
+		)
+
+		assert.Equal(
+			m,
+			string(Received),
+			"netstrings became qik messages",
+		)
+	}
+}
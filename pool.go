@@ -0,0 +1,472 @@
+package proto
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultMaxIdle the count of idle connections
+	// a Pool keeps when MaxIdle is zero
+	DefaultMaxIdle = 2
+)
+
+var (
+	// ErrPoolClosed is returned by Get after
+	// the pool has been closed
+	ErrPoolClosed = fmt.Errorf(
+		"proto: Pool closed",
+	)
+	// ErrPoolExhausted is returned by Get when
+	// MaxOpen connections are in use and the
+	// pool is not set to Wait
+	ErrPoolExhausted = fmt.Errorf(
+		"proto: Pool exhausted",
+	)
+	// ErrUnexpectedBytes an idle connection
+	// was sent bytes out of turn
+	ErrUnexpectedBytes = fmt.Errorf(
+		"proto: idle connection has unread bytes",
+	)
+)
+
+// Pool keeps protocol wrapped keep alive connections
+// so they can be shared across goroutines. Connections
+// that hit an error or are put back in the middle of
+// a message are closed instead of being reused
+type Pool struct {
+	// Dial opens a new raw connection
+	Dial func() (net.Conn, error)
+	// Protocol wraps every dialed connection
+	Protocol Protocol
+	// Handshake when set, runs on every dialed
+	// connection and returns the Protocol of that
+	// connection only, it is used instead of Protocol
+	Handshake func(c net.Conn) (Protocol, error)
+	// MaxIdle the count of idle connections kept,
+	// DefaultMaxIdle when zero
+	MaxIdle int
+	// MaxOpen the count of connections open at
+	// once, unlimited when zero
+	MaxOpen int
+	// IdleTimeout closes connections idle for
+	// longer than this, even when the pool is
+	// not used. Never when zero
+	IdleTimeout time.Duration
+	// Wait makes Get block until a connection is
+	// free instead of returning ErrPoolExhausted
+	Wait bool
+	// Check tests an idle connection before Get hands
+	// it out, on an error it is closed. It is given
+	// the time the connection was put back, Alive
+	// when nil
+	Check func(c net.Conn, t time.Time) error
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	timer  *time.Timer
+	idle   []idleConn
+	open   int
+	closed bool
+}
+
+type idleConn struct {
+	c *PoolConn
+	t time.Time
+}
+
+// PoolConn is a connection handed out by a Pool,
+// reads and writes go through the protocol
+type PoolConn struct {
+	*Conn
+	p       *Pool
+	err     error
+	reading bool
+	writing bool
+	done    bool
+}
+
+// NewPool ...
+func NewPool(p Protocol, Dial func() (net.Conn, error)) *Pool {
+	P := Pool{
+		Dial:     Dial,
+		Protocol: p,
+	}
+
+	return &P
+}
+
+// Get returns an idle connection that passes Check
+// or dials a new one
+func (p *Pool) Get() (*PoolConn, error) {
+	p.mu.Lock()
+
+	for {
+		if p.closed {
+			p.mu.Unlock()
+
+			return nil, ErrPoolClosed
+		}
+
+		p.evict()
+
+		if L := len(p.idle); L > 0 {
+			ic := p.idle[L-1]
+			p.idle = p.idle[:L-1]
+
+			p.mu.Unlock()
+
+			Check := p.Check
+
+			if Check == nil {
+				Check = Alive
+			}
+
+			if Check(ic.c, ic.t) == nil {
+				ic.c.done = false
+
+				return ic.c, nil
+			}
+
+			ic.c.discard()
+
+			p.mu.Lock()
+
+			continue
+		}
+
+		if p.MaxOpen <= 0 || p.open < p.MaxOpen {
+			p.open++
+
+			p.mu.Unlock()
+
+			c, P, err := p.dial()
+
+			if err != nil {
+				p.release()
+
+				return nil, err
+			}
+
+			pc := PoolConn{
+				Conn: WrapConn(P, c).(*Conn),
+				p:    p,
+			}
+
+			return &pc, nil
+		}
+
+		if !p.Wait {
+			p.mu.Unlock()
+
+			return nil, ErrPoolExhausted
+		}
+
+		p.wait()
+	}
+}
+
+// dial opens a raw connection and
+// picks the Protocol for it
+func (p *Pool) dial() (net.Conn, Protocol, error) {
+	c, err := p.Dial()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p.Handshake == nil {
+		return c, p.Protocol, nil
+	}
+
+	P, err := p.Handshake(c)
+
+	if err != nil {
+		c.Close()
+
+		return nil, nil, err
+	}
+
+	return c, P, nil
+}
+
+// Put hands a connection back to the pool, it is
+// closed if it failed, is in the middle of a message
+// or the pool already has MaxIdle idle connections
+func (p *Pool) Put(c *PoolConn) error {
+	if c.p != p {
+		return fmt.Errorf(
+			"proto: connection does not belong to this pool",
+		)
+	}
+
+	if c.done {
+		return nil
+	}
+
+	if c.err != nil || c.reading || c.writing {
+		return c.discard()
+	}
+
+	MaxIdle := p.MaxIdle
+
+	if MaxIdle <= 0 {
+		MaxIdle = DefaultMaxIdle
+	}
+
+	p.mu.Lock()
+
+	if p.closed || len(p.idle) >= MaxIdle {
+		p.mu.Unlock()
+
+		return c.discard()
+	}
+
+	c.done = true
+
+	ic := idleConn{
+		c: c,
+		t: time.Now(),
+	}
+
+	p.evict()
+	p.idle = append(p.idle, ic)
+	p.schedule()
+
+	p.signal()
+	p.mu.Unlock()
+
+	return nil
+}
+
+// Close closes the idle connections, connections
+// that are in use are closed when they are put back
+func (p *Pool) Close() error {
+	p.mu.Lock()
+
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+
+	if p.cond != nil {
+		p.cond.Broadcast()
+	}
+
+	p.mu.Unlock()
+
+	var err error
+
+	for _, ic := range idle {
+		if cerr := ic.c.discard(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// Open the count of connections currently open
+func (p *Pool) Open() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.open
+}
+
+// Idle the count of idle connections
+func (p *Pool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.idle)
+}
+
+// evict closes idle connections past the IdleTimeout,
+// the oldest connections are at the front.
+// p.mu must be held
+func (p *Pool) evict() {
+	if p.IdleTimeout <= 0 {
+		return
+	}
+
+	deadline := time.Now().Add(-p.IdleTimeout)
+
+	i := 0
+	for i < len(p.idle) && p.idle[i].t.Before(deadline) {
+		ic := p.idle[i]
+		ic.c.done = true
+		ic.c.Conn.Close()
+		p.open--
+		i++
+	}
+
+	if i > 0 {
+		p.idle = append(p.idle[:0], p.idle[i:]...)
+		p.signal()
+	}
+}
+
+// schedule starts a timer to evict the oldest
+// idle connection, p.mu must be held
+func (p *Pool) schedule() {
+	if p.IdleTimeout <= 0 || p.timer != nil || p.closed || len(p.idle) == 0 {
+		return
+	}
+
+	p.timer = time.AfterFunc(
+		time.Until(p.idle[0].t.Add(p.IdleTimeout)),
+		p.expire,
+	)
+}
+
+// expire evicts on the timer
+func (p *Pool) expire() {
+	p.mu.Lock()
+
+	p.timer = nil
+	p.evict()
+	p.schedule()
+
+	p.mu.Unlock()
+}
+
+// Alive the Check of a Pool that sets none. It peeks
+// at the socket without blocking, a peer that closed
+// the connection or sent bytes while it was idle fails
+// the check. Connections that are not sockets, or
+// platforms that can not peek, always pass
+func Alive(c net.Conn, t time.Time) error {
+	C, ok := rawConn(c).(syscall.Conn)
+
+	if !ok {
+		return nil
+	}
+
+	return peek(C)
+}
+
+// rawConn unwraps c down to the
+// connection that was dialed
+func rawConn(c net.Conn) net.Conn {
+	switch C := c.(type) {
+	case *PoolConn:
+		return rawConn(C.Conn.Conn)
+
+	case *Conn:
+		return rawConn(C.Conn)
+
+	case interface{ NetConn() net.Conn }:
+		return rawConn(C.NetConn())
+	}
+
+	return c
+}
+
+// release frees a slot for a new connection
+func (p *Pool) release() {
+	p.mu.Lock()
+
+	p.open--
+	p.signal()
+
+	p.mu.Unlock()
+}
+
+// wait blocks until a connection is released,
+// p.mu must be held
+func (p *Pool) wait() {
+	if p.cond == nil {
+		p.cond = sync.NewCond(&p.mu)
+	}
+
+	p.cond.Wait()
+}
+
+// signal wakes a waiting Get, p.mu must be held
+func (p *Pool) signal() {
+	if p.cond != nil {
+		p.cond.Signal()
+	}
+}
+
+// Read read from the connection through the
+// protocol, keeping track of message boundaries
+func (c *PoolConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+
+	switch {
+	case err == ErrEOM:
+		c.reading = false
+
+	case err != nil:
+		c.err = err
+
+	case n > 0:
+		c.reading = true
+	}
+
+	return n, err
+}
+
+// Write write to the connection through the
+// protocol, keeping track of message boundaries
+func (c *PoolConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+
+	if err != nil {
+		c.err = err
+	}
+
+	c.writing = len(b) > 0
+
+	return n, err
+}
+
+// WriteMessage writes a whole message through
+// the protocol, see Conn.WriteMessage
+func (c *PoolConn) WriteMessage(b []byte) (int, error) {
+	return c.WriteMessages(b)
+}
+
+// WriteMessages writes a batch of messages through
+// the protocol, see Conn.WriteMessages
+func (c *PoolConn) WriteMessages(msgs ...[]byte) (int, error) {
+	n, err := c.Conn.WriteMessages(msgs...)
+
+	if err != nil {
+		c.err = err
+	}
+
+	c.writing = false
+
+	return n, err
+}
+
+// Close closes the connection and frees its
+// slot in the pool, use Pool.Put to reuse it
+func (c *PoolConn) Close() error {
+	if c.done {
+		return nil
+	}
+
+	return c.discard()
+}
+
+// discard closes the connection for good
+func (c *PoolConn) discard() error {
+	c.done = true
+
+	err := c.Conn.Close()
+
+	c.p.release()
+
+	return err
+}
@@ -0,0 +1,370 @@
+package proto_test
+
+import (
+	"fmt"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func newPool(t *testing.T) (*proto.Pool, func()) {
+	S, addr, _ := startServer(
+		t,
+		proto.HandlerFunc(func(w io.Writer, m []byte) {
+			w.Write(m)
+		}),
+	)
+
+	P := proto.NewPool(
+		qik.NewProtocol(),
+		func() (net.Conn, error) {
+			return net.Dial("tcp", addr)
+		},
+	)
+
+	return P, func() {
+		P.Close()
+		S.Close()
+	}
+}
+
+func TestPoolReuse(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	P, done := newPool(t)
+	defer done()
+
+	C1, err := P.Get()
+
+	require.Nil(
+		err,
+		"could not get a connection",
+	)
+
+	proto.WriteMessage(C1, []byte("hello"))
+
+	Received, err := proto.ReadMessage(C1)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"hello",
+		string(Received),
+		"bytes match",
+	)
+
+	assert.Nil(
+		P.Put(C1),
+		"put the connection back",
+	)
+
+	assert.Equal(
+		1,
+		P.Idle(),
+		"the connection is idle",
+	)
+
+	C2, err := P.Get()
+
+	require.Nil(
+		err,
+		"could not get a connection",
+	)
+
+	assert.True(
+		C1 == C2,
+		"the idle connection is reused",
+	)
+
+	assert.Equal(
+		1,
+		P.Open(),
+		"only one connection was opened",
+	)
+
+	P.Put(C2)
+}
+
+func TestPoolDiscardMidMessage(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	P, done := newPool(t)
+	defer done()
+
+	C, err := P.Get()
+
+	require.Nil(
+		err,
+		"could not get a connection",
+	)
+
+	C.Write([]byte("half a message"))
+
+	P.Put(C)
+
+	assert.Equal(
+		0,
+		P.Idle(),
+		"a connection in the middle of a message is not reused",
+	)
+
+	assert.Equal(
+		0,
+		P.Open(),
+		"the connection is closed",
+	)
+}
+
+func TestPoolMaxOpen(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	P, done := newPool(t)
+	defer done()
+
+	P.MaxOpen = 1
+
+	C, err := P.Get()
+
+	require.Nil(
+		err,
+		"could not get a connection",
+	)
+
+	_, err = P.Get()
+
+	assert.Equal(
+		proto.ErrPoolExhausted,
+		err,
+		"only one connection may be open",
+	)
+
+	P.Wait = true
+
+	got := make(chan *proto.PoolConn)
+
+	go func() {
+		C, _ := P.Get()
+		got <- C
+	}()
+
+	P.Put(C)
+
+	select {
+	case C2 := <-got:
+		assert.True(
+			C == C2,
+			"the waiting Get receives the connection",
+		)
+
+	case <-time.After(time.Second):
+		t.Fatal("Get did not wake up")
+	}
+}
+
+func TestPoolIdleAndCheck(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	P, done := newPool(t)
+	defer done()
+
+	P.IdleTimeout = time.Millisecond
+
+	C, err := P.Get()
+
+	require.Nil(
+		err,
+		"could not get a connection",
+	)
+
+	P.Put(C)
+
+	time.Sleep(5 * time.Millisecond)
+
+	C2, err := P.Get()
+
+	require.Nil(
+		err,
+		"could not get a connection",
+	)
+
+	assert.True(
+		C != C2,
+		"the stale connection was evicted",
+	)
+
+	P.IdleTimeout = 0
+	P.Check = func(c net.Conn, t time.Time) error {
+		return fmt.Errorf("unhealthy")
+	}
+
+	P.Put(C2)
+
+	C3, err := P.Get()
+
+	require.Nil(
+		err,
+		"could not get a connection",
+	)
+
+	assert.True(
+		C2 != C3,
+		"the unhealthy connection was not handed out",
+	)
+
+	assert.Equal(
+		1,
+		P.Open(),
+		"only the new connection is open",
+	)
+}
+
+func TestPoolAlive(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	L, err := net.Listen("tcp", "127.0.0.1:0")
+
+	require.Nil(
+		err,
+		"could not listen",
+	)
+	defer L.Close()
+
+	Peers := make(chan net.Conn, 4)
+
+	P := proto.NewPool(
+		qik.NewProtocol(),
+		func() (net.Conn, error) {
+			c, err := net.Dial("tcp", L.Addr().String())
+
+			if err != nil {
+				return nil, err
+			}
+
+			p, err := L.Accept()
+
+			if err != nil {
+				c.Close()
+
+				return nil, err
+			}
+
+			Peers <- p
+
+			return c, nil
+		},
+	)
+	defer P.Close()
+
+	C, err := P.Get()
+
+	require.Nil(
+		err,
+		"could not get a connection",
+	)
+
+	P.Put(C)
+
+	C2, err := P.Get()
+
+	require.Nil(
+		err,
+		"could not get a connection",
+	)
+
+	assert.True(
+		C == C2,
+		"the live connection is reused",
+	)
+
+	P.Put(C2)
+
+	Peer := <-Peers
+	Peer.Close()
+
+	// give the FIN time to arrive
+	time.Sleep(10 * time.Millisecond)
+
+	C3, err := P.Get()
+
+	require.Nil(
+		err,
+		"could not get a connection",
+	)
+
+	assert.True(
+		C2 != C3,
+		"the connection the peer closed was not handed out",
+	)
+
+	assert.Equal(
+		1,
+		P.Open(),
+		"only the new connection is open",
+	)
+
+	P.Put(C3)
+
+	Peer = <-Peers
+	Peer.Write([]byte{0x01})
+	defer Peer.Close()
+
+	time.Sleep(10 * time.Millisecond)
+
+	assert.Equal(
+		proto.ErrUnexpectedBytes,
+		proto.Alive(C3, time.Now()),
+		"bytes sent out of turn fail the check",
+	)
+}
+
+func TestPoolIdleTimer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	P, done := newPool(t)
+	defer done()
+
+	P.IdleTimeout = 5 * time.Millisecond
+
+	C, err := P.Get()
+
+	require.Nil(
+		err,
+		"could not get a connection",
+	)
+
+	P.Put(C)
+
+	assert.Equal(
+		1,
+		P.Idle(),
+		"the connection is idle",
+	)
+
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Equal(
+		0,
+		P.Idle(),
+		"the unused pool evicted the connection",
+	)
+
+	assert.Equal(
+		0,
+		P.Open(),
+		"the connection was closed",
+	)
+}
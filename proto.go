@@ -11,6 +11,11 @@ var (
 	ErrEOM = fmt.Errorf(
 		"EOM",
 	)
+	// ErrMessageTooLarge a message is larger than
+	// the max message size of the reader
+	ErrMessageTooLarge = fmt.Errorf(
+		"message too large",
+	)
 )
 
 // Protocol is an interface to build the actual
@@ -24,7 +29,9 @@ type Protocol interface {
 
 // Conn is a net.Conn but
 // read and writing bytes goes
-// through the protocol
+// through the protocol. WrapConn
+// makes its writes goroutine safe,
+// see SyncWriter
 type Conn struct {
 	net.Conn
 	W io.Writer
@@ -43,6 +50,12 @@ func (c *Conn) Read(b []byte) (int, error) {
 	return c.R.Read(b)
 }
 
+// SetMaxMessageSize limits the size of the messages
+// read off of the connection, see LimitMessages
+func (c *Conn) SetMaxMessageSize(Max int) {
+	c.R = LimitMessages(c.R, Max)
+}
+
 // MessageReader has the exact same interface as
 // io.Reader but can also return a proto.EOM error
 // which designates the end of a message but not the
@@ -60,13 +73,14 @@ type MessageWriter interface {
 }
 
 // WrapConn wraps a network connection around
-// a protocol
+// a protocol, many goroutines may write messages
+// to it with WriteMessage
 func WrapConn(p Protocol, c net.Conn) net.Conn {
 	W, R := Wrap(p, c, c)
 
 	C := Conn{
 		Conn: c,
-		W:    W,
+		W:    NewSyncWriter(W),
 		R:    R,
 	}
 
@@ -86,7 +100,9 @@ func Wrap(p Protocol, W io.Writer, R io.Reader) (io.Writer, io.Reader) {
 // to the writer, returns any errors.
 // returns the number of messages written successful
 // otherwise it will return a non-nil error and the
-// number of bytes in the buffer
+// number of bytes in the buffer. A reader with a max
+// message size returns ErrMessageTooLarge, the
+// message being written is then left unfinished
 func CopyMessages(W io.Writer, R io.Reader, B []byte, N int) (int, error) {
 	i := 0
 	infinite := N < 0
@@ -134,19 +150,28 @@ func CopyMessages(W io.Writer, R io.Reader, B []byte, N int) (int, error) {
 	return i, nil
 }
 
-// WriteMessage ...
+// WriteMessage writes the bytes and ends the message,
+// an empty body writes a single empty message
 func WriteMessage(W io.Writer, Bytes []byte) (int, error) {
+	if bw, ok := W.(BatchWriter); ok {
+		return bw.WriteMessage(Bytes)
+	}
+
 	S := 0
 
-	n, err := W.Write(Bytes)
+	// the empty buffer would already end the
+	// message, only write the end of message
+	if len(Bytes) > 0 {
+		n, err := W.Write(Bytes)
 
-	S += n
+		S += n
 
-	if err != nil {
-		return S, err
+		if err != nil {
+			return S, err
+		}
 	}
 
-	_, err = W.Write(nil)
+	_, err := W.Write(nil)
 
 	if err != nil {
 		return S, err
@@ -157,28 +182,73 @@ func WriteMessage(W io.Writer, Bytes []byte) (int, error) {
 
 // ReadMessage ...
 func ReadMessage(R io.Reader) ([]byte, error) {
-	var B []byte
+	return ReadMessageInto(nil, R)
+}
 
-	l := 16
-	for {
-		b := make([]byte, l)
+// ReadMessageInto reads a message like ReadMessage but
+// appends it to dst, which is only grown when the
+// message does not fit. Reusing dst[:0] between
+// messages reads them without allocating
+func ReadMessageInto(dst []byte, R io.Reader) ([]byte, error) {
+	B, err := readMessageInto(dst, R)
 
-		n, err := R.Read(b)
+	if err == io.EOF {
+		return B, nil
+	}
 
-		if n == l {
-			l *= 2
-		}
+	return B, err
+}
 
-		B = append(B, b[:n]...)
+// ReadWholeMessage reads a message like ReadMessage
+// but never takes the end of the stream for the end
+// of a message. It returns io.EOF when the stream
+// ends between messages and io.ErrUnexpectedEOF
+// when it ends inside of one
+func ReadWholeMessage(R io.Reader) ([]byte, error) {
+	return readWholeMessageInto(nil, R)
+}
 
-		if err == io.EOF {
-			return B, nil
+// readWholeMessageInto is ReadWholeMessage
+// appending to dst
+func readWholeMessageInto(dst []byte, R io.Reader) ([]byte, error) {
+	B, err := readMessageInto(dst, R)
+
+	if err == io.EOF && len(B) > len(dst) {
+		return B, io.ErrUnexpectedEOF
+	}
+
+	return B, err
+}
+
+// readMessage reads up to the end of message
+// like ReadMessage but hands back io.EOF so
+// callers can tell a message from a closed stream
+func readMessage(R io.Reader) ([]byte, error) {
+	return readMessageInto(nil, R)
+}
+
+// readMessageInto reads straight into the spare
+// capacity of B, append doubles it once it is full
+func readMessageInto(dst []byte, R io.Reader) ([]byte, error) {
+	B := dst
+
+	for {
+		if len(B) == cap(B) {
+			B = append(B, 0)[:len(B)]
 		}
 
+		n, err := R.Read(B[len(B):cap(B)])
+
+		B = B[:len(B)+n]
+
 		if err == ErrEOM {
 			break
 		}
 
+		if err == ErrMessageTooLarge {
+			return dst, err
+		}
+
 		if err != nil {
 			return B, err
 		}
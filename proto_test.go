@@ -1,7 +1,9 @@
 package proto
 
 import (
+	"bytes"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"testing"
 )
 
@@ -32,3 +34,31 @@ func TestCopy(t *testing.T) {
 		"there are no bytes",
 	)
 }
+
+func TestReadWholeMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := ReadWholeMessage(bytes.NewReader(nil))
+
+	assert.Equal(
+		io.EOF,
+		err,
+		"the stream ended between messages",
+	)
+
+	_, err = ReadWholeMessage(bytes.NewReader([]byte("cut")))
+
+	assert.Equal(
+		io.ErrUnexpectedEOF,
+		err,
+		"the stream ended inside a message",
+	)
+
+	B, err := ReadMessage(bytes.NewReader([]byte("cut")))
+
+	assert.Equal(
+		"cut",
+		string(B),
+		"ReadMessage takes the end of the stream for the end of a message",
+	)
+}
@@ -3,7 +3,10 @@ package qik
 import (
 	"fmt"
 	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/internal/flat"
 	"io"
+	"io/ioutil"
+	"net"
 )
 
 // Protocol ...
@@ -26,18 +29,37 @@ func NewProtocol() *Protocol {
 	return &p
 }
 
-// Reader read messages using this Reader
+func init() {
+	proto.Register("qik", func() proto.Protocol {
+		return NewProtocol()
+	})
+
+	proto.Register("qikv", func() proto.Protocol {
+		return NewVarintProtocol(0)
+	})
+}
+
+// Reader read messages using this Reader,
+// messages past Max bytes are skipped and
+// return proto.ErrMessageTooLarge
 type Reader struct {
 	R       io.Reader
 	Buff    []byte
 	Count   int
 	Content []byte
+	Max     int
+	Size    int
 }
 
-// Writer encode messages using this Writer
+// Writer encode messages using this Writer,
+// Bufs and Heads are reused by WriteMessages
 type Writer struct {
-	W    io.Writer
-	Buff []byte
+	W     io.Writer
+	Buff  []byte
+	Bufs  net.Buffers
+	Heads []byte
+
+	flat flat.Buffer
 }
 
 // NewReader creates a new Reader that
@@ -85,6 +107,7 @@ func (r *Reader) Read(b []byte) (int, error) {
 		}
 
 		r.Count -= n
+		r.Size += n
 
 		return n, nil
 	}
@@ -105,9 +128,15 @@ func (r *Reader) Read(b []byte) (int, error) {
 	r.Count = I(r.Buff)
 
 	if r.Count == 0 {
+		r.Size = 0
+
 		return 0, proto.ErrEOM
 	}
 
+	if r.Max > 0 && r.Size+r.Count > r.Max {
+		return 0, r.skip()
+	}
+
 	L := len(b)
 
 	if r.Count < L {
@@ -123,10 +152,44 @@ func (r *Reader) Read(b []byte) (int, error) {
 	}
 
 	r.Count -= n
+	r.Size += n
 
 	return n, err
 }
 
+// SetMaxMessageSize ...
+func (r *Reader) SetMaxMessageSize(Max int) {
+	r.Max = Max
+}
+
+// skip drops the rest of a message past Max
+// frame by frame up to its end of message
+func (r *Reader) skip() error {
+	for {
+		_, err := io.CopyN(ioutil.Discard, r.R, int64(r.Count))
+
+		r.Count = 0
+
+		if err != nil {
+			return err
+		}
+
+		_, err = io.ReadFull(r.R, r.Buff)
+
+		if err != nil {
+			return err
+		}
+
+		r.Count = I(r.Buff)
+
+		if r.Count == 0 {
+			r.Size = 0
+
+			return proto.ErrMessageTooLarge
+		}
+	}
+}
+
 // Write writes the bytes to the given buffer
 // according to the protocol the first
 // two bytes designate the message length
@@ -165,6 +228,108 @@ func (w *Writer) Write(b []byte) (int, error) {
 	return s, nil
 }
 
+// WriteMessage writes the whole message and its
+// end of message in a single write, see WriteMessages
+func (w *Writer) WriteMessage(b []byte) (int, error) {
+	return w.WriteMessages(b)
+}
+
+// WriteMessages writes every message, headers and
+// end of message frames included, in a single write.
+// TCP and unix connections get a single writev, other
+// writers a copy of it all. Returns the count of
+// message bytes written
+func (w *Writer) WriteMessages(msgs ...[]byte) (int, error) {
+	// don't hold on to the last batch's messages
+	for i := range w.Bufs {
+		w.Bufs[i] = nil
+	}
+
+	Bufs := w.Bufs[:0]
+	Heads := w.Heads[:0]
+
+	for _, m := range msgs {
+		s := 0
+
+		for s < len(m) {
+			L := len(m) - s
+
+			if L > 0xFFFF {
+				L = 0xFFFF
+			}
+
+			Heads = append(Heads, byte(L>>8), byte(L&0xFF))
+
+			Bufs = append(Bufs, Heads[len(Heads)-2:], m[s:s+L])
+
+			s += L
+		}
+
+		Heads = append(Heads, 0, 0)
+
+		Bufs = append(Bufs, Heads[len(Heads)-2:])
+	}
+
+	w.Bufs = Bufs
+	w.Heads = Heads
+
+	switch w.W.(type) {
+	case *net.TCPConn, *net.UnixConn:
+		// WriteTo consumes its copy of the slice
+		n, err := Bufs.WriteTo(w.W)
+
+		return written(n, msgs), err
+	}
+
+	// other writers would get a write per
+	// buffer, gather them into one instead
+	Flat := w.flat.Bytes()
+
+	for _, b := range Bufs {
+		Flat = append(Flat, b...)
+	}
+
+	n, err := w.flat.Write(w.W, Flat)
+
+	return written(int64(n), msgs), err
+}
+
+// written counts the message bytes in the
+// first n bytes written by WriteMessages
+func written(n int64, msgs [][]byte) int {
+	S := 0
+
+	for _, m := range msgs {
+		s := 0
+
+		for s < len(m) {
+			L := len(m) - s
+
+			if L > 0xFFFF {
+				L = 0xFFFF
+			}
+
+			n -= 2
+
+			if n <= 0 {
+				return S
+			}
+
+			if n < int64(L) {
+				return S + int(n)
+			}
+
+			n -= int64(L)
+			S += L
+			s += L
+		}
+
+		n -= 2
+	}
+
+	return S
+}
+
 // I convert 2 bytes to an int
 func I(bs []byte) int {
 	x := int(bs[0])
@@ -5,12 +5,14 @@ package qik
 import (
 	"bytes"
 	"github.com/johnmcconnell/nop"
+	"github.com/johnmcconnell/proto"
 	"testing"
 )
 
 func encodeBenchmarkSerial(size int, b *testing.B) {
 	bs, _ := randomBytes(size)
 
+	b.ReportAllocs()
 	b.StopTimer()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -46,6 +48,7 @@ func decodeBenchmarkSerial(size int, b *testing.B) {
 	bs, _ := randomBytes(size)
 	buff := make([]byte, 512)
 
+	b.ReportAllocs()
 	b.StopTimer()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -76,3 +79,62 @@ func BenchmarkDecode_1M(b *testing.B) {
 func BenchmarkDecode_100M(b *testing.B) {
 	decodeBenchmarkSerial(100*1000*1000, b)
 }
+
+func readMessageBenchmarkSerial(size int, b *testing.B, into bool) {
+	bs, _ := randomBytes(size)
+
+	E := bytes.NewBuffer(nil)
+	proto.WriteMessage(NewWriter(E), bs)
+
+	Encoded := E.Bytes()
+
+	R := bytes.NewReader(Encoded)
+	D := NewReader(R)
+
+	var B []byte
+
+	b.ReportAllocs()
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		R.Reset(Encoded)
+
+		if into {
+			B, _ = proto.ReadMessageInto(B[:0], D)
+		} else {
+			B, _ = proto.ReadMessage(D)
+		}
+	}
+}
+
+func BenchmarkReadMessage_100B(b *testing.B) {
+	readMessageBenchmarkSerial(100, b, false)
+}
+
+func BenchmarkReadMessage_1K(b *testing.B) {
+	readMessageBenchmarkSerial(1000, b, false)
+}
+
+func BenchmarkReadMessage_100K(b *testing.B) {
+	readMessageBenchmarkSerial(100*1000, b, false)
+}
+
+func BenchmarkReadMessage_1M(b *testing.B) {
+	readMessageBenchmarkSerial(1*1000*1000, b, false)
+}
+
+func BenchmarkReadMessageInto_100B(b *testing.B) {
+	readMessageBenchmarkSerial(100, b, true)
+}
+
+func BenchmarkReadMessageInto_1K(b *testing.B) {
+	readMessageBenchmarkSerial(1000, b, true)
+}
+
+func BenchmarkReadMessageInto_100K(b *testing.B) {
+	readMessageBenchmarkSerial(100*1000, b, true)
+}
+
+func BenchmarkReadMessageInto_1M(b *testing.B) {
+	readMessageBenchmarkSerial(1*1000*1000, b, true)
+}
@@ -10,6 +10,7 @@ import (
 	"io"
 	"io/ioutil"
 	"math"
+	"net"
 	"testing"
 )
 
@@ -684,3 +685,198 @@ func TestCopyMessages(t *testing.T) {
 		)
 	}
 }
+
+func TestMaxMessageSize(t *testing.T) {
+	assert := assert.New(t)
+
+	Large, err := randomBytes(200 * 1000)
+
+	assert.Nil(
+		err,
+		"could not create random bytes",
+	)
+
+	for _, p := range []proto.Protocol{NewProtocol(), NewVarintProtocol(1000)} {
+		B := bytes.NewBuffer(nil)
+		W, R := proto.Wrap(p, B, B)
+
+		proto.WriteMessage(W, []byte("small"))
+		proto.WriteMessage(W, Large)
+		proto.WriteMessage(W, []byte("again"))
+
+		R = proto.LimitMessages(R, 100)
+
+		Received, err := proto.ReadMessage(R)
+
+		assert.Nil(
+			err,
+			"bytes not read",
+		)
+
+		assert.Equal(
+			"small",
+			string(Received),
+			"bytes match",
+		)
+
+		_, err = proto.ReadMessage(R)
+
+		assert.Equal(
+			proto.ErrMessageTooLarge,
+			err,
+			"the message is past the max",
+		)
+
+		Received, err = proto.ReadMessage(R)
+
+		assert.Nil(
+			err,
+			"the reader skipped to the next message",
+		)
+
+		assert.Equal(
+			"again",
+			string(Received),
+			"bytes match",
+		)
+	}
+}
+
+// writeCounter counts the writes and fails
+// once more than Max bytes are written
+type writeCounter struct {
+	B      bytes.Buffer
+	Max    int
+	Writes int
+}
+
+func (w *writeCounter) Write(b []byte) (int, error) {
+	w.Writes++
+
+	if w.Max > 0 && w.B.Len()+len(b) > w.Max {
+		n, _ := w.B.Write(b[:w.Max-w.B.Len()])
+
+		return n, io.ErrShortWrite
+	}
+
+	return w.B.Write(b)
+}
+
+func TestWriteMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	Large, err := randomBytes(200 * 1000)
+
+	assert.Nil(
+		err,
+		"could not create random bytes",
+	)
+
+	Messages := [][]byte{[]byte("hello"), nil, Large}
+
+	Expected := bytes.NewBuffer(nil)
+	E := NewWriter(Expected)
+
+	for _, m := range Messages {
+		if len(m) > 0 {
+			E.Write(m)
+		}
+
+		E.Write(nil)
+	}
+
+	C := writeCounter{}
+
+	n, err := NewWriter(&C).WriteMessages(Messages...)
+
+	assert.Nil(
+		err,
+		"bytes not written",
+	)
+
+	assert.Equal(
+		5+len(Large),
+		n,
+		"the message bytes were counted",
+	)
+
+	assert.Equal(
+		Expected.Bytes(),
+		C.B.Bytes(),
+		"the encoding matches Write",
+	)
+
+	assert.Equal(
+		1,
+		C.Writes,
+		"the batch was a single write",
+	)
+
+	C = writeCounter{
+		Max: 10,
+	}
+
+	n, err = NewWriter(&C).WriteMessages([]byte("hello"), []byte("world"))
+
+	assert.Equal(
+		io.ErrShortWrite,
+		err,
+		"the write failed",
+	)
+
+	assert.Equal(
+		5,
+		n,
+		"only hello made it out",
+	)
+}
+
+func TestWriteMessagesTCP(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	require.Nil(
+		err,
+		"could not listen",
+	)
+	defer l.Close()
+
+	go func() {
+		c, err := l.Accept()
+
+		if err != nil {
+			return
+		}
+
+		defer c.Close()
+
+		NewWriter(c).WriteMessages([]byte("one"), []byte("two"), nil)
+	}()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+
+	require.Nil(
+		err,
+		"could not dial",
+	)
+	defer c.Close()
+
+	R := NewReader(c)
+
+	for _, m := range []string{"one", "two", ""} {
+		Received, err := proto.ReadMessage(R)
+
+		assert.Nil(
+			err,
+			"bytes not read",
+		)
+
+		assert.Equal(
+			m,
+			string(Received),
+			"bytes match",
+		)
+	}
+}
@@ -0,0 +1,273 @@
+package qik
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/johnmcconnell/proto"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	// maxInt the largest frame length an int holds
+	maxInt = int(^uint(0) >> 1)
+	// DefaultMaxFrame the largest frame the varint
+	// protocol reads or writes unless configured
+	DefaultMaxFrame = 16 * 1024 * 1024
+)
+
+// VarintProtocol is qik with a uvarint frame
+// header instead of the 2 byte one, so large
+// messages are not split into 0xFFFF chunks.
+// A MaxFrame of zero uses DefaultMaxFrame
+type VarintProtocol struct {
+	MaxFrame int
+}
+
+// NewReader ...
+func (p *VarintProtocol) NewReader(R io.Reader) io.Reader {
+	r := NewVarintReader(R)
+
+	if p.MaxFrame > 0 {
+		r.MaxFrame = p.MaxFrame
+	}
+
+	return r
+}
+
+// NewWriter ...
+func (p *VarintProtocol) NewWriter(W io.Writer) io.Writer {
+	w := NewVarintWriter(W)
+
+	if p.MaxFrame > 0 {
+		w.MaxFrame = p.MaxFrame
+	}
+
+	return w
+}
+
+// NewVarintProtocol ...
+func NewVarintProtocol(MaxFrame int) *VarintProtocol {
+	p := VarintProtocol{
+		MaxFrame: MaxFrame,
+	}
+
+	return &p
+}
+
+// VarintReader read messages using this Reader,
+// messages past Max bytes are skipped and
+// return proto.ErrMessageTooLarge
+type VarintReader struct {
+	R        io.Reader
+	Buff     []byte
+	Count    int
+	MaxFrame int
+	Max      int
+	Size     int
+}
+
+// VarintWriter encode messages using this Writer
+type VarintWriter struct {
+	W        io.Writer
+	Buff     []byte
+	MaxFrame int
+}
+
+// NewVarintReader creates a new VarintReader that
+// will decode messages from an io.Reader
+func NewVarintReader(R io.Reader) *VarintReader {
+	r := VarintReader{
+		R:        R,
+		Buff:     make([]byte, 1),
+		Count:    0,
+		MaxFrame: DefaultMaxFrame,
+	}
+
+	return &r
+}
+
+// NewVarintWriter creates a new VarintWriter that
+// will encode messages from an io.Writer
+func NewVarintWriter(W io.Writer) *VarintWriter {
+	w := VarintWriter{
+		W:        W,
+		Buff:     make([]byte, binary.MaxVarintLen64),
+		MaxFrame: DefaultMaxFrame,
+	}
+
+	return &w
+}
+
+// Read reads the from the given buffer
+// according to the protocol a uvarint
+// designates the frame length
+func (r *VarintReader) Read(b []byte) (int, error) {
+	if r.Count == 0 {
+		x, err := r.header()
+
+		if err != nil {
+			return 0, err
+		}
+
+		if x == 0 {
+			r.Size = 0
+
+			return 0, proto.ErrEOM
+		}
+
+		r.Count = x
+
+		if r.Max > 0 && r.Size+r.Count > r.Max {
+			return 0, r.skip()
+		}
+	}
+
+	L := len(b)
+
+	if r.Count < L {
+		L = r.Count
+	}
+
+	n, err := r.R.Read(
+		b[:L],
+	)
+
+	r.Count -= n
+	r.Size += n
+
+	return n, err
+}
+
+// SetMaxMessageSize ...
+func (r *VarintReader) SetMaxMessageSize(Max int) {
+	r.Max = Max
+}
+
+// skip drops the rest of a message past Max
+// frame by frame up to its end of message
+func (r *VarintReader) skip() error {
+	for {
+		_, err := io.CopyN(ioutil.Discard, r.R, int64(r.Count))
+
+		r.Count = 0
+
+		if err != nil {
+			return err
+		}
+
+		x, err := r.header()
+
+		if err != nil {
+			return err
+		}
+
+		r.Count = x
+
+		if r.Count == 0 {
+			r.Size = 0
+
+			return proto.ErrMessageTooLarge
+		}
+	}
+}
+
+// header reads the uvarint frame length
+// one byte at a time
+func (r *VarintReader) header() (int, error) {
+	var x uint64
+	var s uint
+
+	for i := 0; i < binary.MaxVarintLen64; i++ {
+		n, err := io.ReadFull(r.R, r.Buff)
+
+		if err == io.EOF && i > 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			return n, err
+		}
+
+		c := r.Buff[0]
+
+		if c < 0x80 {
+			x |= uint64(c) << s
+
+			if r.MaxFrame > 0 && x > uint64(r.MaxFrame) {
+				return 0, fmt.Errorf(
+					"frame of %v bytes is larger than the max of %v bytes",
+					x,
+					r.MaxFrame,
+				)
+			}
+
+			// without a max the length must still fit
+			if x > uint64(maxInt) {
+				return 0, fmt.Errorf(
+					"frame of %v bytes is too large",
+					x,
+				)
+			}
+
+			return int(x), nil
+		}
+
+		x |= uint64(c&0x7F) << s
+		s += 7
+	}
+
+	return 0, fmt.Errorf(
+		"frame header is longer than %v bytes",
+		binary.MaxVarintLen64,
+	)
+}
+
+// Write writes the bytes to the given buffer
+// according to the protocol a uvarint
+// designates the frame length
+func (w *VarintWriter) Write(b []byte) (int, error) {
+	L := len(b)
+
+	if L == 0 {
+		H := binary.PutUvarint(w.Buff, 0)
+
+		_, err := w.W.Write(w.Buff[:H])
+
+		return 0, err
+	}
+
+	M := w.MaxFrame
+
+	if M <= 0 {
+		M = L
+	}
+
+	s := 0
+
+	for s < L {
+		BL := L - s
+
+		if BL > M {
+			BL = M
+		}
+
+		H := binary.PutUvarint(w.Buff, uint64(BL))
+
+		_, err := w.W.Write(w.Buff[:H])
+
+		if err != nil {
+			return s, err
+		}
+
+		n, err := w.W.Write(b[s : s+BL])
+
+		s += n
+
+		if err != nil {
+			return s, err
+		}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,190 @@
+package qik
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/johnmcconnell/proto"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+func TestVarintEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	BS := make([]byte, 300)
+	W := bytes.NewBuffer(nil)
+	E := NewVarintWriter(W)
+
+	n, err := E.Write(BS)
+
+	assert.Nil(
+		err,
+		"Error is nil",
+	)
+
+	assert.Equal(
+		300,
+		n,
+		"300 bytes were written",
+	)
+
+	_, err = E.Write(nil)
+
+	assert.Nil(
+		err,
+		"Error is nil",
+	)
+
+	assert.Equal(
+		[]byte{0xAC, 0x02},
+		W.Bytes()[:2],
+		"300 is a two byte uvarint",
+	)
+
+	assert.Equal(
+		2+300+1,
+		W.Len(),
+		"one header, the payload and the end of message",
+	)
+}
+
+func TestVarintMaxFrame(t *testing.T) {
+	assert := assert.New(t)
+
+	BS, err := randomBytes(1000)
+
+	assert.Nil(
+		err,
+		"could not create random bytes",
+	)
+
+	W := bytes.NewBuffer(nil)
+	E := NewVarintWriter(W)
+	E.MaxFrame = 400
+
+	_, err = proto.WriteMessage(E, BS)
+
+	assert.Nil(
+		err,
+		"bytes not written",
+	)
+
+	assert.Equal(
+		3*2+1000+1,
+		W.Len(),
+		"the payload is split into three frames",
+	)
+
+	Received, err := proto.ReadMessage(NewVarintReader(W))
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		BS,
+		Received,
+		"bytes match",
+	)
+
+	W = bytes.NewBuffer(nil)
+	E = NewVarintWriter(W)
+
+	_, err = proto.WriteMessage(E, BS)
+
+	D := NewVarintReader(W)
+	D.MaxFrame = 400
+
+	_, err = D.Read(make([]byte, 16))
+
+	assert.NotNil(
+		err,
+		"a frame over the max is an error",
+	)
+
+	// a length past what an int holds
+	H := make([]byte, binary.MaxVarintLen64)
+	H = H[:binary.PutUvarint(H, 1<<63)]
+
+	D = NewVarintReader(bytes.NewReader(H))
+	D.MaxFrame = 0
+
+	_, err = D.Read(make([]byte, 16))
+
+	assert.NotNil(
+		err,
+		"a frame too large for an int is an error without a max",
+	)
+}
+
+func TestVarintMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	// 1 Megabyte
+	BS1, err := randomBytes(1 * 1000 * 1000)
+
+	assert.Nil(
+		err,
+		"could not create random bytes",
+	)
+
+	BS2 := []byte{0, 1, 2}
+
+	W := bytes.NewBuffer(nil)
+	E, _ := proto.Wrap(NewVarintProtocol(0), W, nil)
+
+	proto.WriteMessage(E, BS1)
+	proto.WriteMessage(E, BS2)
+
+	D := NewVarintReader(W)
+
+	Received, err := proto.ReadMessage(D)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		BS1,
+		Received,
+		"bytes match",
+	)
+
+	Received, err = proto.ReadMessage(D)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		BS2,
+		Received,
+		"bytes match",
+	)
+
+	_, err = D.Read(make([]byte, 16))
+
+	assert.Equal(
+		io.EOF,
+		err,
+		"Using io.EOF to designate end of file",
+	)
+}
+
+func TestVarintTruncatedHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	D := NewVarintReader(bytes.NewReader([]byte{0x80}))
+
+	_, err := D.Read(make([]byte, 16))
+
+	assert.Equal(
+		io.ErrUnexpectedEOF,
+		err,
+		"the header ended early",
+	)
+}
@@ -0,0 +1,188 @@
+package proto
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Factory creates a new Protocol
+type Factory func() Protocol
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a protocol available by name to
+// Lookup, Dial and Listen. Protocol packages call it
+// from init, it panics if the name is taken
+func Register(name string, f Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if f == nil {
+		panic("proto: Register factory is nil")
+	}
+
+	if _, dup := registry[name]; dup {
+		panic("proto: Register called twice for protocol " + name)
+	}
+
+	registry[name] = f
+}
+
+// Lookup creates the protocol registered
+// under the name
+func Lookup(name string) (Protocol, bool) {
+	registryMu.RLock()
+	f, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	return f(), true
+}
+
+// Protocols the sorted names of the
+// registered protocols
+func Protocols() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var names []string
+
+	for name := range registry {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Dial connects to an address such as "qik+tcp://host:port"
+// or "slim+unix:///path/to.sock", the connection comes back
+// wrapped with the protocol named by the scheme
+func Dial(addr string) (net.Conn, error) {
+	p, network, address, err := parseAddr(addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := net.Dial(network, address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return WrapConn(p, c), nil
+}
+
+// Listen listens on an address such as "qik+tcp://:8080",
+// accepted connections come back wrapped with the
+// protocol named by the scheme
+func Listen(addr string) (net.Listener, error) {
+	p, network, address, err := parseAddr(addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen(network, address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	L := Listener{
+		Listener: l,
+		Protocol: p,
+	}
+
+	return &L, nil
+}
+
+// Listener wraps every accepted
+// connection with the Protocol
+type Listener struct {
+	net.Listener
+	Protocol Protocol
+	// Handshake when set, runs on every accepted
+	// connection and returns the Protocol of that
+	// connection only, it is used instead of
+	// Protocol. It runs in Accept, a connection
+	// whose handshake fails is closed and skipped
+	Handshake func(c net.Conn) (Protocol, error)
+}
+
+// Accept accepts a connection and
+// wraps it with the Protocol
+func (l *Listener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if l.Handshake == nil {
+			return WrapConn(l.Protocol, c), nil
+		}
+
+		P, err := l.Handshake(c)
+
+		if err != nil {
+			c.Close()
+
+			continue
+		}
+
+		return WrapConn(P, c), nil
+	}
+}
+
+// parseAddr splits "name+network://address" into
+// the protocol, the network and the address
+func parseAddr(addr string) (Protocol, string, string, error) {
+	u, err := url.Parse(addr)
+
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	i := strings.Index(u.Scheme, "+")
+
+	if i < 0 {
+		return nil, "", "", fmt.Errorf(
+			"proto: address [%v] must look like protocol+network://address",
+			addr,
+		)
+	}
+
+	name := u.Scheme[:i]
+	network := u.Scheme[i+1:]
+
+	p, ok := Lookup(name)
+
+	if !ok {
+		return nil, "", "", fmt.Errorf(
+			"proto: unknown protocol [%v], is its package imported?",
+			name,
+		)
+	}
+
+	address := u.Host
+
+	if strings.HasPrefix(network, "unix") {
+		address = u.Path
+	}
+
+	return p, network, address, nil
+}
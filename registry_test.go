@@ -0,0 +1,225 @@
+package proto_test
+
+import (
+	"fmt"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLookup(t *testing.T) {
+	assert := assert.New(t)
+
+	p, ok := proto.Lookup("qik")
+
+	assert.True(
+		ok,
+		"qik registers itself",
+	)
+
+	assert.IsType(
+		&qik.Protocol{},
+		p,
+		"the factory creates a qik protocol",
+	)
+
+	_, ok = proto.Lookup("unknown")
+
+	assert.False(
+		ok,
+		"nothing is registered as unknown",
+	)
+
+	assert.Contains(
+		proto.Protocols(),
+		"slim",
+		"slim registers itself",
+	)
+}
+
+func TestRegister(t *testing.T) {
+	assert := assert.New(t)
+
+	// the registry is global, so the name must be
+	// new each time the test runs
+	name := fmt.Sprintf("registry-test-%v", time.Now().UnixNano())
+
+	proto.Register(name, func() proto.Protocol {
+		return qik.NewProtocol()
+	})
+
+	_, ok := proto.Lookup(name)
+
+	assert.True(
+		ok,
+		"the protocol was registered",
+	)
+
+	assert.Panics(
+		func() {
+			proto.Register(name, func() proto.Protocol {
+				return qik.NewProtocol()
+			})
+		},
+		"names can not be registered twice",
+	)
+}
+
+func TestDialListen(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := proto.Listen("qik+tcp://127.0.0.1:0")
+
+	require.Nil(
+		err,
+		"could not listen",
+	)
+	defer l.Close()
+
+	go func() {
+		c, err := l.Accept()
+
+		if err != nil {
+			return
+		}
+
+		defer c.Close()
+
+		m, _ := proto.ReadMessage(c)
+		proto.WriteMessage(c, m)
+	}()
+
+	C, err := proto.Dial("qik+tcp://" + l.Addr().String())
+
+	require.Nil(
+		err,
+		"could not dial",
+	)
+	defer C.Close()
+
+	proto.WriteMessage(C, []byte("hello"))
+
+	Received, err := proto.ReadMessage(C)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"hello",
+		string(Received),
+		"bytes match",
+	)
+
+	_, err = proto.Dial("unknown+tcp://127.0.0.1:1")
+
+	assert.NotNil(
+		err,
+		"the protocol is not registered",
+	)
+
+	_, err = proto.Dial("tcp://127.0.0.1:1")
+
+	assert.NotNil(
+		err,
+		"the scheme names no protocol",
+	)
+}
+
+func TestListenerHandshake(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	require.Nil(
+		err,
+		"could not listen",
+	)
+
+	// the peer says y to use qik
+	L := proto.Listener{
+		Listener: l,
+		Handshake: func(c net.Conn) (proto.Protocol, error) {
+			B := make([]byte, 1)
+
+			_, err := io.ReadFull(c, B)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if B[0] != 'y' {
+				return nil, fmt.Errorf("refused")
+			}
+
+			return qik.NewProtocol(), nil
+		},
+	}
+	defer L.Close()
+
+	go func() {
+		c, err := L.Accept()
+
+		if err != nil {
+			return
+		}
+
+		defer c.Close()
+
+		m, _ := proto.ReadMessage(c)
+		proto.WriteMessage(c, m)
+	}()
+
+	Refused, err := net.Dial("tcp", l.Addr().String())
+
+	require.Nil(
+		err,
+		"could not dial",
+	)
+	defer Refused.Close()
+
+	Refused.Write([]byte{'n'})
+
+	_, err = Refused.Read(make([]byte, 1))
+
+	assert.Equal(
+		io.EOF,
+		err,
+		"the refused connection is closed",
+	)
+
+	c, err := net.Dial("tcp", l.Addr().String())
+
+	require.Nil(
+		err,
+		"could not dial",
+	)
+
+	c.Write([]byte{'y'})
+
+	C := proto.WrapConn(qik.NewProtocol(), c)
+	defer C.Close()
+
+	proto.WriteMessage(C, []byte("hello"))
+
+	Received, err := proto.ReadMessage(C)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"hello",
+		string(Received),
+		"the next connection is accepted",
+	)
+}
@@ -0,0 +1,352 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/johnmcconnell/proto"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// HeaderSize the count of bytes in front of
+	// every message, an 8 byte correlation ID and
+	// a kind byte
+	HeaderSize = 9
+	// KindRequest the message is a request
+	KindRequest = 0
+	// KindResponse the message is a response
+	KindResponse = 1
+	// KindError the message is an error response
+	KindError = 2
+)
+
+var (
+	// ErrShutdown is returned by Call once the
+	// connection is closed or broken
+	ErrShutdown = fmt.Errorf(
+		"rpc: connection is shut down",
+	)
+	// ErrTimeout is returned by Call when no
+	// response arrived in time
+	ErrTimeout = fmt.Errorf(
+		"rpc: call timed out",
+	)
+)
+
+// ServerError an error returned by the remote handler
+type ServerError string
+
+func (e ServerError) Error() string {
+	return string(e)
+}
+
+// Handler answers a single request
+type Handler interface {
+	ServeRPC(req []byte) ([]byte, error)
+}
+
+// HandlerFunc lets an ordinary function be
+// used as a Handler
+type HandlerFunc func([]byte) ([]byte, error)
+
+// ServeRPC calls f(req)
+func (f HandlerFunc) ServeRPC(req []byte) ([]byte, error) {
+	return f(req)
+}
+
+type response struct {
+	body []byte
+	err  error
+}
+
+type request struct {
+	ID   uint64
+	body []byte
+}
+
+// Client pipelines calls over a single protocol
+// wrapped connection, responses are matched to
+// their calls by correlation ID and may arrive
+// in any order. Requests are written by a single
+// goroutine, a call gives up on its turn to write
+// when it times out
+type Client struct {
+	C io.ReadWriteCloser
+
+	mu       sync.Mutex
+	seq      uint64
+	pending  map[uint64]chan response
+	requests chan request
+	done     chan struct{}
+	err      error
+}
+
+// NewClient starts reading responses off of the
+// connection, it should already be wrapped with
+// a protocol such as proto.WrapConn
+func NewClient(C io.ReadWriteCloser) *Client {
+	c := Client{
+		C:        C,
+		pending:  make(map[uint64]chan response),
+		requests: make(chan request),
+		done:     make(chan struct{}),
+	}
+
+	go c.read()
+	go c.write()
+
+	return &c
+}
+
+// Call sends the request and waits for its response,
+// the timeout covers both the write and the response.
+// A timeout of zero waits until the connection fails
+func (c *Client) Call(req []byte, timeout time.Duration) ([]byte, error) {
+	ch := make(chan response, 1)
+
+	c.mu.Lock()
+
+	if c.err != nil {
+		c.mu.Unlock()
+
+		return nil, c.err
+	}
+
+	c.seq++
+	ID := c.seq
+	c.pending[ID] = ch
+
+	c.mu.Unlock()
+
+	var expired <-chan time.Time
+
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+
+		expired = t.C
+	}
+
+	// the request is only sent if the
+	// writer takes it in time
+	select {
+	case c.requests <- request{ID: ID, body: req}:
+
+	case r := <-ch:
+		return r.body, r.err
+
+	case <-expired:
+		c.forget(ID)
+
+		return nil, ErrTimeout
+	}
+
+	select {
+	case r := <-ch:
+		return r.body, r.err
+
+	case <-expired:
+		c.forget(ID)
+
+		return nil, ErrTimeout
+	}
+}
+
+// forget drops a call that timed out
+func (c *Client) forget(ID uint64) {
+	c.mu.Lock()
+	delete(c.pending, ID)
+	c.mu.Unlock()
+}
+
+// Close closes the connection, calls waiting
+// for a response fail with ErrShutdown
+func (c *Client) Close() error {
+	err := c.C.Close()
+
+	c.shutdown(ErrShutdown)
+
+	return err
+}
+
+// write sends the requests one at a time
+func (c *Client) write() {
+	for {
+		select {
+		case r := <-c.requests:
+			err := write(c.C, r.ID, KindRequest, r.body)
+
+			if err != nil {
+				c.shutdown(err)
+
+				return
+			}
+
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// read hands every response to its waiting call,
+// messages of any other kind are dropped
+func (c *Client) read() {
+	for {
+		m, err := proto.ReadWholeMessage(c.C)
+
+		if err == io.EOF {
+			err = ErrShutdown
+		}
+
+		if err != nil {
+			c.shutdown(err)
+
+			return
+		}
+
+		if len(m) < HeaderSize {
+			c.shutdown(ErrShutdown)
+
+			return
+		}
+
+		Kind := m[8]
+
+		if Kind != KindResponse && Kind != KindError {
+			continue
+		}
+
+		ID := binary.BigEndian.Uint64(m)
+
+		c.mu.Lock()
+		ch, ok := c.pending[ID]
+		delete(c.pending, ID)
+		c.mu.Unlock()
+
+		// the call already timed out
+		if !ok {
+			continue
+		}
+
+		r := response{
+			body: m[HeaderSize:],
+		}
+
+		if Kind == KindError {
+			r.body = nil
+			r.err = ServerError(m[HeaderSize:])
+		}
+
+		ch <- r
+	}
+}
+
+// shutdown fails all waiting calls
+func (c *Client) shutdown(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	c.err = err
+	close(c.done)
+
+	for ID, ch := range c.pending {
+		ch <- response{
+			err: err,
+		}
+
+		delete(c.pending, ID)
+	}
+}
+
+// ServeConn answers requests off of the connection
+// until it is closed, each request is handled on its
+// own goroutine so responses go out as they finish
+func ServeConn(C io.ReadWriter, h Handler) error {
+	var wmu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		m, err := proto.ReadWholeMessage(C)
+
+		if err == io.EOF {
+			return nil
+		}
+
+		// a request cut short is not handled
+		if err != nil {
+			return err
+		}
+
+		if len(m) < HeaderSize || m[8] != KindRequest {
+			return fmt.Errorf(
+				"rpc: malformed request of %v bytes",
+				len(m),
+			)
+		}
+
+		wg.Add(1)
+
+		go func(m []byte) {
+			defer wg.Done()
+
+			ID, Kind, B := serve(h, m)
+
+			wmu.Lock()
+			write(C, ID, Kind, B)
+			wmu.Unlock()
+		}(m)
+	}
+}
+
+// NewHandler adapts a Handler to a proto.Handler so
+// requests can be served by a proto.Server, responses
+// on a connection then go out in order
+func NewHandler(h Handler) proto.Handler {
+	return proto.HandlerFunc(func(w io.Writer, m []byte) {
+		if len(m) < HeaderSize || m[8] != KindRequest {
+			return
+		}
+
+		ID, Kind, B := serve(h, m)
+
+		w.Write(header(ID, Kind, B))
+	})
+}
+
+// serve runs the handler for the request m
+func serve(h Handler, m []byte) (uint64, byte, []byte) {
+	ID := binary.BigEndian.Uint64(m)
+
+	B, err := h.ServeRPC(m[HeaderSize:])
+
+	if err != nil {
+		return ID, KindError, []byte(err.Error())
+	}
+
+	return ID, KindResponse, B
+}
+
+// header puts the ID and kind in front of B
+func header(ID uint64, Kind byte, B []byte) []byte {
+	M := make([]byte, HeaderSize+len(B))
+
+	binary.BigEndian.PutUint64(M, ID)
+	M[8] = Kind
+	copy(M[HeaderSize:], B)
+
+	return M
+}
+
+// write writes a single message
+func write(W io.Writer, ID uint64, Kind byte, B []byte) error {
+	_, err := proto.WriteMessage(W, header(ID, Kind, B))
+
+	return err
+}
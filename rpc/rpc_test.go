@@ -0,0 +1,354 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func pipe(h Handler) (*Client, net.Conn) {
+	a, b := net.Pipe()
+
+	A := proto.WrapConn(qik.NewProtocol(), a)
+	B := proto.WrapConn(qik.NewProtocol(), b)
+
+	go ServeConn(B, h)
+
+	return NewClient(A), B
+}
+
+func TestPipelinedCalls(t *testing.T) {
+	assert := assert.New(t)
+
+	// later requests finish first
+	C, _ := pipe(
+		HandlerFunc(func(req []byte) ([]byte, error) {
+			i, err := strconv.Atoi(string(req))
+
+			if err != nil {
+				return nil, err
+			}
+
+			time.Sleep(time.Duration(10-i) * time.Millisecond)
+
+			return []byte(fmt.Sprintf("reply %v", i)), nil
+		}),
+	)
+	defer C.Close()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			B, err := C.Call([]byte(strconv.Itoa(i)), time.Second)
+
+			assert.Nil(
+				err,
+				"there is no error",
+			)
+
+			assert.Equal(
+				fmt.Sprintf("reply %v", i),
+				string(B),
+				"the response matches the request",
+			)
+		}(i)
+	}
+
+	wg.Wait()
+
+	_, err := C.Call([]byte("not a number"), time.Second)
+
+	assert.IsType(
+		ServerError(""),
+		err,
+		"handler errors are returned to the caller",
+	)
+}
+
+func TestCallTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	C, _ := pipe(
+		HandlerFunc(func(req []byte) ([]byte, error) {
+			if string(req) == "slow" {
+				time.Sleep(50 * time.Millisecond)
+			}
+
+			return req, nil
+		}),
+	)
+	defer C.Close()
+
+	_, err := C.Call([]byte("slow"), time.Millisecond)
+
+	assert.Equal(
+		ErrTimeout,
+		err,
+		"the call timed out",
+	)
+
+	B, err := C.Call([]byte("fast"), time.Second)
+
+	assert.Nil(
+		err,
+		"the late response is dropped",
+	)
+
+	assert.Equal(
+		"fast",
+		string(B),
+		"bytes match",
+	)
+}
+
+func TestWriteTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	// the peer never reads
+	a, b := net.Pipe()
+	defer b.Close()
+
+	C := NewClient(proto.WrapConn(qik.NewProtocol(), a))
+	defer C.Close()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			Start := time.Now()
+
+			_, err := C.Call([]byte("stuck"), 50*time.Millisecond)
+
+			assert.Equal(
+				ErrTimeout,
+				err,
+				"the call timed out",
+			)
+
+			assert.True(
+				time.Since(Start) < time.Second,
+				"the timeout covers the write",
+			)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestUnexpectedKind(t *testing.T) {
+	assert := assert.New(t)
+
+	a, b := net.Pipe()
+
+	A := proto.WrapConn(qik.NewProtocol(), a)
+	B := proto.WrapConn(qik.NewProtocol(), b)
+
+	// the peer sends a request with the
+	// call's ID before the response
+	go func() {
+		m, err := proto.ReadMessage(B)
+
+		if err != nil {
+			return
+		}
+
+		ID := binary.BigEndian.Uint64(m)
+
+		write(B, ID, KindRequest, []byte("request"))
+		write(B, ID, KindResponse, []byte("response"))
+	}()
+
+	C := NewClient(A)
+	defer C.Close()
+
+	R, err := C.Call([]byte("call"), time.Second)
+
+	assert.Nil(
+		err,
+		"there is no error",
+	)
+
+	assert.Equal(
+		"response",
+		string(R),
+		"requests are not responses",
+	)
+}
+
+// truncated encodes the message with qik
+// and cuts it off inside of its payload
+func truncated(ID uint64, Kind byte, B []byte) []byte {
+	Buff := bytes.NewBuffer(nil)
+
+	write(qik.NewWriter(Buff), ID, Kind, B)
+
+	return Buff.Bytes()[:Buff.Len()-len(B)/2]
+}
+
+func TestTruncatedResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	a, b := net.Pipe()
+
+	// the peer drops the connection
+	// in the middle of the response
+	go func() {
+		m, err := proto.ReadMessage(qik.NewReader(b))
+
+		if err != nil {
+			return
+		}
+
+		b.Write(truncated(binary.BigEndian.Uint64(m), KindResponse, bytes.Repeat([]byte("partial."), 10)))
+		b.Close()
+	}()
+
+	C := NewClient(proto.WrapConn(qik.NewProtocol(), a))
+	defer C.Close()
+
+	_, err := C.Call([]byte("call"), time.Second)
+
+	assert.Equal(
+		io.ErrUnexpectedEOF,
+		err,
+		"a response cut short fails the call",
+	)
+}
+
+func TestTruncatedRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	a, b := net.Pipe()
+
+	go func() {
+		a.Write(truncated(1, KindRequest, bytes.Repeat([]byte("partial."), 10)))
+		a.Close()
+	}()
+
+	Handled := false
+
+	err := ServeConn(
+		proto.WrapConn(qik.NewProtocol(), b),
+		HandlerFunc(func(req []byte) ([]byte, error) {
+			Handled = true
+
+			return req, nil
+		}),
+	)
+
+	assert.Equal(
+		io.ErrUnexpectedEOF,
+		err,
+		"a request cut short ends the connection",
+	)
+
+	assert.False(
+		Handled,
+		"a request cut short is not handled",
+	)
+}
+
+func TestConnectionDrop(t *testing.T) {
+	assert := assert.New(t)
+
+	block := make(chan struct{})
+
+	C, S := pipe(
+		HandlerFunc(func(req []byte) ([]byte, error) {
+			<-block
+
+			return req, nil
+		}),
+	)
+	defer close(block)
+
+	done := make(chan error)
+
+	go func() {
+		_, err := C.Call([]byte("waiting"), 0)
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	S.Close()
+
+	select {
+	case err := <-done:
+		assert.NotNil(
+			err,
+			"the call fails when the connection drops",
+		)
+
+	case <-time.After(time.Second):
+		t.Fatal("call did not fail")
+	}
+
+	_, err := C.Call([]byte("again"), 0)
+
+	assert.NotNil(
+		err,
+		"calls fail after the connection drops",
+	)
+}
+
+func TestNewHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	assert.Nil(
+		err,
+		"could not listen",
+	)
+
+	S := proto.NewServer(
+		qik.NewProtocol(),
+		NewHandler(HandlerFunc(func(req []byte) ([]byte, error) {
+			return append(req, '!'), nil
+		})),
+	)
+	defer S.Close()
+
+	go S.Serve(l)
+
+	c, err := net.Dial("tcp", l.Addr().String())
+
+	assert.Nil(
+		err,
+		"could not dial",
+	)
+
+	C := NewClient(proto.WrapConn(qik.NewProtocol(), c))
+	defer C.Close()
+
+	B, err := C.Call([]byte("hi"), time.Second)
+
+	assert.Nil(
+		err,
+		"there is no error",
+	)
+
+	assert.Equal(
+		"hi!",
+		string(B),
+		"bytes match",
+	)
+}
@@ -0,0 +1,336 @@
+package proto
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrServerClosed is returned by Serve after
+	// the server has been closed
+	ErrServerClosed = fmt.Errorf(
+		"proto: Server closed",
+	)
+)
+
+// Handler responds to a single message. Bytes
+// written to w make up the reply message, which
+// is ended once ServeMessage returns
+type Handler interface {
+	ServeMessage(w io.Writer, m []byte)
+}
+
+// HandlerFunc lets an ordinary function be
+// used as a Handler
+type HandlerFunc func(io.Writer, []byte)
+
+// ServeMessage calls f(w, m)
+func (f HandlerFunc) ServeMessage(w io.Writer, m []byte) {
+	f(w, m)
+}
+
+// Server accepts connections, wraps each one with
+// the Protocol and hands every message to the Handler.
+// A connection stays open for as many messages as
+// the peer sends
+type Server struct {
+	Protocol Protocol
+	Handler  Handler
+	// Protocols when set, each connection starts
+	// with a handshake choosing one of them
+	// instead of using Protocol
+	Protocols []NamedProtocol
+	// Handshake when set, runs at the start of each
+	// connection and returns the Protocol of that
+	// connection only, it is used instead of
+	// Protocol and Protocols
+	Handshake func(c net.Conn) (Protocol, error)
+	// MaxMessageSize when set, larger messages
+	// are dropped instead of handled
+	MaxMessageSize int
+	// ErrorLog logs accept errors and handler panics,
+	// the log package's standard logger when nil
+	ErrorLog *log.Logger
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+// NewServer ...
+func NewServer(p Protocol, h Handler) *Server {
+	s := Server{
+		Protocol: p,
+		Handler:  h,
+	}
+
+	return &s
+}
+
+// ListenAndServe listens on the TCP address and
+// serves messages with the protocol and handler
+func ListenAndServe(addr string, p Protocol, h Handler) error {
+	return NewServer(p, h).ListenAndServe(addr)
+}
+
+// ListenAndServe listens on the TCP address
+// and then calls Serve
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve accepts connections on the listener and
+// serves each one on its own goroutine. It always
+// returns a non-nil error and closes the listener
+func (s *Server) Serve(l net.Listener) error {
+	defer l.Close()
+
+	if !s.track(l, nil, true) {
+		return ErrServerClosed
+	}
+	defer s.track(l, nil, false)
+
+	var delay time.Duration
+
+	for {
+		c, err := l.Accept()
+
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else {
+					delay *= 2
+				}
+
+				if delay > time.Second {
+					delay = time.Second
+				}
+
+				s.logf("proto: accept error: %v; retrying in %v", err, delay)
+				time.Sleep(delay)
+
+				continue
+			}
+
+			return err
+		}
+
+		delay = 0
+
+		go s.ServeConn(c)
+	}
+}
+
+// ServeConn serves messages on a single connection
+// until the peer closes it, an error occurs or the
+// server is closed. The connection is closed on return
+func (s *Server) ServeConn(c net.Conn) {
+	defer c.Close()
+
+	if !s.track(nil, c, true) {
+		return
+	}
+	defer s.track(nil, c, false)
+
+	var W io.Writer
+	var R io.Reader
+
+	switch {
+	case s.Handshake != nil:
+		P, err := s.Handshake(c)
+
+		if err != nil {
+			return
+		}
+
+		W, R = Wrap(P, c, c)
+
+	case len(s.Protocols) > 0:
+		C, _, err := AcceptNegotiation(c, s.Protocols)
+
+		if err != nil {
+			return
+		}
+
+		W, R = C, C
+
+	default:
+		W, R = Wrap(s.Protocol, c, c)
+	}
+
+	if s.MaxMessageSize > 0 {
+		R = LimitMessages(R, s.MaxMessageSize)
+	}
+
+	for {
+		m, err := readMessage(R)
+
+		if err == ErrMessageTooLarge {
+			continue
+		}
+
+		if err != nil {
+			return
+		}
+
+		if !s.serveMessage(W, m) {
+			return
+		}
+	}
+}
+
+// serveMessage runs the handler and ends the
+// reply, it returns false if the connection
+// can no longer be used
+func (s *Server) serveMessage(W io.Writer, m []byte) (ok bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			const size = 64 << 10
+
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+
+			s.logf("proto: panic serving message: %v\n%s", err, buf)
+
+			ok = false
+		}
+	}()
+
+	r := replyWriter{
+		W: W,
+	}
+
+	s.Handler.ServeMessage(&r, m)
+
+	if r.err != nil {
+		return false
+	}
+
+	if r.open {
+		_, err := W.Write(nil)
+
+		if err != nil {
+			return false
+		}
+	}
+
+	// a buffered protocol must not sit on the reply
+	if f, ok := W.(Flusher); ok {
+		return f.Flush() == nil
+	}
+
+	return true
+}
+
+// Close closes all listeners and connections,
+// Serve returns ErrServerClosed afterwards
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+
+	var err error
+
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	for c := range s.conns {
+		c.Close()
+	}
+
+	return err
+}
+
+// track adds or removes a listener or connection,
+// it returns false if the server is closed
+func (s *Server) track(l net.Listener, c net.Conn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if add && s.closed {
+		return false
+	}
+
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+		s.conns = make(map[net.Conn]struct{})
+	}
+
+	if l != nil {
+		if add {
+			s.listeners[l] = struct{}{}
+		} else {
+			delete(s.listeners, l)
+		}
+	}
+
+	if c != nil {
+		if add {
+			s.conns[c] = struct{}{}
+		} else {
+			delete(s.conns, c)
+		}
+	}
+
+	return true
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+
+		return
+	}
+
+	log.Printf(format, args...)
+}
+
+// replyWriter remembers whether a reply message
+// was started so the server can end it
+type replyWriter struct {
+	W    io.Writer
+	open bool
+	err  error
+}
+
+// Write writes to the protocol writer, writing
+// the nil buffer ends the reply early
+func (r *replyWriter) Write(b []byte) (int, error) {
+	n, err := r.W.Write(b)
+
+	r.open = len(b) > 0
+
+	if err != nil {
+		r.err = err
+	}
+
+	return n, err
+}
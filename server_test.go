@@ -0,0 +1,158 @@
+package proto_test
+
+import (
+	"bytes"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"testing"
+)
+
+func startServer(t *testing.T, h proto.Handler, options ...func(*proto.Server)) (*proto.Server, string, chan error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	require.Nil(
+		t,
+		err,
+		"could not listen",
+	)
+
+	S := proto.NewServer(qik.NewProtocol(), h)
+	S.ErrorLog = log.New(ioutil.Discard, "", 0)
+
+	for _, o := range options {
+		o(S)
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- S.Serve(l)
+	}()
+
+	return S, l.Addr().String(), done
+}
+
+func TestServerEcho(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	S, addr, done := startServer(
+		t,
+		proto.HandlerFunc(func(w io.Writer, m []byte) {
+			w.Write(bytes.ToUpper(m))
+		}),
+	)
+
+	c, err := net.Dial("tcp", addr)
+
+	require.Nil(
+		err,
+		"could not dial",
+	)
+
+	C := proto.WrapConn(qik.NewProtocol(), c)
+
+	for _, m := range []string{"hello", "world", "again"} {
+		_, err = proto.WriteMessage(C, []byte(m))
+
+		require.Nil(
+			err,
+			"bytes not written",
+		)
+
+		Received, err := proto.ReadMessage(C)
+
+		require.Nil(
+			err,
+			"bytes not read",
+		)
+
+		assert.Equal(
+			string(bytes.ToUpper([]byte(m))),
+			string(Received),
+			"the reply matches",
+		)
+	}
+
+	C.Close()
+
+	assert.Nil(
+		S.Close(),
+		"closed the server",
+	)
+
+	assert.Equal(
+		proto.ErrServerClosed,
+		<-done,
+		"Serve returns after Close",
+	)
+}
+
+func TestServerPanic(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	S, addr, _ := startServer(
+		t,
+		proto.HandlerFunc(func(w io.Writer, m []byte) {
+			if string(m) == "panic" {
+				panic("handler panic")
+			}
+
+			w.Write(m)
+		}),
+	)
+	defer S.Close()
+
+	c, err := net.Dial("tcp", addr)
+
+	require.Nil(
+		err,
+		"could not dial",
+	)
+
+	C := proto.WrapConn(qik.NewProtocol(), c)
+
+	proto.WriteMessage(C, []byte("panic"))
+
+	_, err = C.Read(make([]byte, 16))
+
+	assert.Equal(
+		io.EOF,
+		err,
+		"the connection is closed after a panic",
+	)
+
+	C.Close()
+
+	c, err = net.Dial("tcp", addr)
+
+	require.Nil(
+		err,
+		"could not dial",
+	)
+
+	C = proto.WrapConn(qik.NewProtocol(), c)
+	defer C.Close()
+
+	proto.WriteMessage(C, []byte("ok"))
+
+	Received, err := proto.ReadMessage(C)
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		"ok",
+		string(Received),
+		"the server still serves new connections",
+	)
+}
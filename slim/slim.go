@@ -3,6 +3,7 @@ package slim
 import (
 	"bytes"
 	"fmt"
+	"github.com/johnmcconnell/proto"
 	"io"
 	"strings"
 )
@@ -42,7 +43,17 @@ func DecodeString(raw string) (string, error) {
 // DecodeMessage reads bytes off the reader and
 // cleans the escape bytes
 func DecodeMessage(R io.Reader, W io.Writer) ([]byte, error) {
+	return DecodeMessageMax(R, W, 0)
+}
+
+// DecodeMessageMax decodes like DecodeMessage but stops
+// writing once the message is past Max bytes, the rest
+// of the message is read and dropped and it returns
+// the remaining bytes and proto.ErrMessageTooLarge.
+// A Max of zero means no limit
+func DecodeMessageMax(R io.Reader, W io.Writer, Max int) ([]byte, error) {
 	BS := make([]byte, BufferSize)
+	S := 0
 
 	for {
 		n, err := R.Read(BS)
@@ -54,6 +65,16 @@ func DecodeMessage(R io.Reader, W io.Writer) ([]byte, error) {
 				return nil, err
 			}
 
+			S += len(MBS)
+
+			if Max > 0 && S > Max {
+				if RBS == nil {
+					return nil, io.ErrUnexpectedEOF
+				}
+
+				return *RBS, proto.ErrMessageTooLarge
+			}
+
 			W.Write(MBS)
 
 			if RBS == nil {
@@ -76,6 +97,16 @@ func DecodeMessage(R io.Reader, W io.Writer) ([]byte, error) {
 			return nil, err
 		}
 
+		S += len(MBS)
+
+		if Max > 0 && S > Max {
+			if RBS != nil {
+				return *RBS, proto.ErrMessageTooLarge
+			}
+
+			return skipMessage(R, BS)
+		}
+
 		W.Write(MBS)
 
 		if RBS != nil {
@@ -84,6 +115,36 @@ func DecodeMessage(R io.Reader, W io.Writer) ([]byte, error) {
 	}
 }
 
+// skipMessage reads up to the TerminalByte,
+// it returns the bytes past it
+func skipMessage(R io.Reader, BS []byte) ([]byte, error) {
+	escapeNext := false
+
+	for {
+		n, err := R.Read(BS)
+
+		for i, b := range BS[:n] {
+			switch {
+			case escapeNext:
+				escapeNext = false
+
+			case b == EscapeByte:
+				escapeNext = true
+
+			case b == TerminalByte:
+				RBS := make([]byte, n-i-1)
+				copy(RBS, BS[i+1:n])
+
+				return RBS, proto.ErrMessageTooLarge
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
 // DecodeBytes removes the two escape bytes
 // it returns the decoded bytes in the first return arg
 // if it runs into the terminal byte it will return
@@ -215,3 +276,242 @@ func EncodeBytes(BS []byte) ([]byte, int) {
 
 	return message, L
 }
+
+// Protocol ...
+type Protocol struct{}
+
+// NewReader ...
+func (p *Protocol) NewReader(R io.Reader) io.Reader {
+	return NewReader(R)
+}
+
+// NewWriter ...
+func (p *Protocol) NewWriter(W io.Writer) io.Writer {
+	return NewWriter(W)
+}
+
+// NewProtocol ...
+func NewProtocol() *Protocol {
+	p := Protocol{}
+
+	return &p
+}
+
+func init() {
+	proto.Register("slim", func() proto.Protocol {
+		return NewProtocol()
+	})
+}
+
+// Reader read messages using this Reader.
+// Bytes read past a TerminalByte are kept
+// for the next call to Read, messages past
+// Max bytes are skipped and return
+// proto.ErrMessageTooLarge
+type Reader struct {
+	R       io.Reader
+	Buff    []byte
+	Pending []byte
+	Escape  bool
+	Err     error
+	Max     int
+	Size    int
+}
+
+// Writer encode messages using this Writer
+type Writer struct {
+	W io.Writer
+}
+
+// NewReader creates a new Reader that
+// will decode messages from an io.Reader
+func NewReader(R io.Reader) *Reader {
+	r := Reader{
+		R:    R,
+		Buff: make([]byte, BufferSize),
+	}
+
+	return &r
+}
+
+// NewWriter creates a new Writer that
+// will encode messages to an io.Writer
+func NewWriter(W io.Writer) *Writer {
+	w := Writer{
+		W: W,
+	}
+
+	return &w
+}
+
+// Read decodes bytes into b, it returns
+// proto.ErrEOM when it reaches a TerminalByte
+func (r *Reader) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	for {
+		for len(r.Pending) == 0 {
+			if r.Err != nil {
+				return 0, r.readErr()
+			}
+
+			n, err := r.R.Read(r.Buff)
+
+			r.Pending = r.Buff[:n]
+			r.Err = err
+
+			if n == 0 && err == nil {
+				return 0, nil
+			}
+		}
+
+		n, err := r.decode(b)
+
+		r.Size += n
+
+		if r.Max > 0 && r.Size > r.Max {
+			r.Size = 0
+
+			return 0, r.skip()
+		}
+
+		if err == proto.ErrEOM {
+			r.Size = 0
+		}
+
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// SetMaxMessageSize ...
+func (r *Reader) SetMaxMessageSize(Max int) {
+	r.Max = Max
+}
+
+// readErr hands back the read error, only io.EOF
+// is kept so a read past a deadline can be retried
+func (r *Reader) readErr() error {
+	err := r.Err
+
+	if err != io.EOF {
+		r.Err = nil
+	}
+
+	return err
+}
+
+// skip drops the rest of a message past Max
+// up to its TerminalByte
+func (r *Reader) skip() error {
+	for {
+		for i, c := range r.Pending {
+			switch {
+			case r.Escape:
+				r.Escape = false
+
+			case c == EscapeByte:
+				r.Escape = true
+
+			case c == TerminalByte:
+				r.Pending = r.Pending[i+1:]
+
+				return proto.ErrMessageTooLarge
+			}
+		}
+
+		r.Pending = nil
+
+		if r.Err != nil {
+			return r.readErr()
+		}
+
+		n, err := r.R.Read(r.Buff)
+
+		r.Pending = r.Buff[:n]
+		r.Err = err
+	}
+}
+
+// decode moves the pending bytes into b
+// it stops early at the TerminalByte
+func (r *Reader) decode(b []byte) (int, error) {
+	i := 0
+	n := 0
+
+	for i < len(r.Pending) && n < len(b) {
+		c := r.Pending[i]
+
+		if r.Escape {
+			if c != EscapeByte && c != TerminalByte {
+				r.Pending = r.Pending[i+1:]
+				r.Escape = false
+
+				return n, fmt.Errorf(
+					"Next character was [%v] but previous was an escape character",
+					c,
+				)
+			}
+
+			b[n] = c
+			n++
+			r.Escape = false
+			i++
+
+			continue
+		}
+
+		if c == TerminalByte {
+			// hand back the bytes before the terminal
+			// byte first, the next Read returns EOM
+			if n > 0 {
+				break
+			}
+
+			r.Pending = r.Pending[i+1:]
+
+			return 0, proto.ErrEOM
+		}
+
+		if c == EscapeByte {
+			r.Escape = true
+		} else {
+			b[n] = c
+			n++
+		}
+
+		i++
+	}
+
+	r.Pending = r.Pending[i:]
+
+	return n, nil
+}
+
+// Write encodes the bytes to the underlying
+// writer, writing the nil buffer or the empty
+// buffer writes the TerminalByte
+func (w *Writer) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		_, err := w.W.Write(
+			[]byte{
+				TerminalByte,
+			},
+		)
+
+		return 0, err
+	}
+
+	MBS, L := EncodeBytes(b)
+
+	_, err := w.W.Write(MBS)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return L, nil
+}
@@ -4,11 +4,31 @@ import (
 	"bytes"
 	"crypto/rand"
 	"fmt"
+	"github.com/johnmcconnell/proto"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"io"
+	"os"
 	"testing"
 )
 
+// flaky fails its first read like a
+// read past a deadline
+type flaky struct {
+	R      io.Reader
+	Failed bool
+}
+
+func (f *flaky) Read(b []byte) (int, error) {
+	if !f.Failed {
+		f.Failed = true
+
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	return f.R.Read(b)
+}
+
 func randomBytes(S int) ([]byte, error) {
 	BS := make([]byte, S)
 
@@ -217,6 +237,306 @@ func TestLargeBytes(t *testing.T) {
 	)
 }
 
+func TestReader(t *testing.T) {
+	assert := assert.New(t)
+
+	BS := []byte{1, EscapeByte, TerminalByte, 2, TerminalByte, 3, 4, TerminalByte}
+
+	R := bytes.NewReader(BS)
+	D := NewReader(R)
+	B := make([]byte, 16)
+
+	n, err := D.Read(B)
+
+	assert.Nil(
+		err,
+		"Error is nil",
+	)
+
+	assert.Equal(
+		[]byte{1, TerminalByte, 2},
+		B[:n],
+		"bytes match",
+	)
+
+	n, err = D.Read(B)
+
+	assert.Equal(
+		proto.ErrEOM,
+		err,
+		"Using proto to designate end of message",
+	)
+
+	assert.Equal(
+		0,
+		n,
+		"No bytes were read",
+	)
+
+	n, err = D.Read(B)
+
+	assert.Nil(
+		err,
+		"Error is nil",
+	)
+
+	assert.Equal(
+		[]byte{3, 4},
+		B[:n],
+		"the remaining bytes are kept for the next message",
+	)
+
+	n, err = D.Read(B)
+
+	assert.Equal(
+		proto.ErrEOM,
+		err,
+		"Using proto to designate end of message",
+	)
+
+	n, err = D.Read(B)
+
+	assert.Equal(
+		io.EOF,
+		err,
+		"Using io.EOF to designate end of file",
+	)
+
+	assert.Equal(
+		0,
+		n,
+		"No bytes were read",
+	)
+}
+
+func TestReaderSmallBuffer(t *testing.T) {
+	assert := assert.New(t)
+
+	BS := []byte{EscapeByte, EscapeByte, EscapeByte, TerminalByte, 5, TerminalByte}
+
+	R := bytes.NewReader(BS)
+	D := NewReader(R)
+	D.Buff = make([]byte, 1)
+
+	Received, err := proto.ReadMessage(D)
+
+	assert.Nil(
+		err,
+		"Error is nil",
+	)
+
+	assert.Equal(
+		[]byte{EscapeByte, TerminalByte, 5},
+		Received,
+		"escape bytes split across reads are decoded",
+	)
+}
+
+func TestReaderBadEscape(t *testing.T) {
+	assert := assert.New(t)
+
+	R := bytes.NewReader([]byte{1, EscapeByte, 2, TerminalByte})
+	D := NewReader(R)
+	B := make([]byte, 16)
+
+	_, err := D.Read(B)
+
+	assert.NotNil(
+		err,
+		"an escape byte must be followed by an escaped byte",
+	)
+}
+
+func TestWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	W := bytes.NewBuffer(nil)
+	E := NewWriter(W)
+
+	n, err := E.Write([]byte{1, TerminalByte, 2})
+
+	assert.Nil(
+		err,
+		"Error is nil",
+	)
+
+	assert.Equal(
+		3,
+		n,
+		"3 bytes were written",
+	)
+
+	n, err = E.Write(nil)
+
+	assert.Nil(
+		err,
+		"Error is nil",
+	)
+
+	assert.Equal(
+		0,
+		n,
+		"0 bytes were written",
+	)
+
+	assert.Equal(
+		[]byte{1, EscapeByte, TerminalByte, 2, TerminalByte},
+		W.Bytes(),
+		"bytes match",
+	)
+}
+
+func TestCopyMessages(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	L := 10
+
+	MessagesEncoded := bytes.NewBuffer(nil)
+	Encoder, _ := proto.Wrap(NewProtocol(), MessagesEncoded, nil)
+
+	Messages := make([][]byte, L)
+
+	for i := range Messages {
+		Message, err := randomBytes(1000)
+
+		assert.Nil(
+			err,
+			"could not create random bytes",
+		)
+
+		_, err = proto.WriteMessage(Encoder, Message)
+
+		assert.Nil(
+			err,
+			"bytes not written",
+		)
+
+		Messages[i] = Message
+	}
+
+	Decoder := NewReader(MessagesEncoded)
+
+	MessagesEncodedAgain := bytes.NewBuffer(nil)
+	EncoderAgain := NewWriter(MessagesEncodedAgain)
+
+	B := make([]byte, 512)
+
+	_, err := proto.CopyMessages(EncoderAgain, Decoder, B, L)
+
+	assert.Nil(
+		err,
+		"there is no error",
+	)
+
+	DecoderAgain := NewReader(MessagesEncodedAgain)
+
+	for _, Sent := range Messages {
+		Received, err := proto.ReadMessage(DecoderAgain)
+
+		assert.Nil(
+			err,
+			"bytes not read",
+		)
+
+		require.Equal(
+			Sent,
+			Received,
+			"bytes match",
+		)
+	}
+}
+
+func TestReaderMaxMessageSize(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+	E := NewWriter(B)
+
+	proto.WriteMessage(E, bytes.Repeat([]byte{EscapeByte}, 2000))
+	proto.WriteMessage(E, []byte("small"))
+
+	D := NewReader(B)
+	D.SetMaxMessageSize(100)
+
+	_, err := proto.ReadMessage(D)
+
+	assert.Equal(
+		proto.ErrMessageTooLarge,
+		err,
+		"the first message is too large",
+	)
+
+	Received, err := proto.ReadMessage(D)
+
+	assert.Nil(
+		err,
+		"the next message is read",
+	)
+
+	assert.Equal(
+		"small",
+		string(Received),
+		"bytes match",
+	)
+}
+
+func TestDecodeMessageMax(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+
+	EncodeMessage(bytes.NewReader(bytes.Repeat([]byte{1}, 2000)), B)
+	EncodeMessage(bytes.NewReader([]byte{2, 3}), B)
+
+	W := bytes.NewBuffer(nil)
+
+	RBS, err := DecodeMessageMax(B, W, 100)
+
+	assert.Equal(
+		proto.ErrMessageTooLarge,
+		err,
+		"the first message is too large",
+	)
+
+	assert.Equal(
+		[]byte{2, 3, TerminalByte},
+		RBS,
+		"the bytes past the message are returned",
+	)
+}
+
+func TestReadAfterTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+
+	proto.WriteMessage(NewWriter(B), []byte("after"))
+
+	R := NewReader(&flaky{R: B})
+
+	_, err := proto.ReadMessage(R)
+
+	assert.Equal(
+		os.ErrDeadlineExceeded,
+		err,
+		"the read timed out",
+	)
+
+	Received, err := proto.ReadMessage(R)
+
+	assert.Nil(
+		err,
+		"the reader recovers from a timeout",
+	)
+
+	assert.Equal(
+		"after",
+		string(Received),
+		"bytes match",
+	)
+}
+
 func encodeBenchmarkSerial(size int, b *testing.B) {
 	bs, _ := randomBytes(100)
 
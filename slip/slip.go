@@ -0,0 +1,323 @@
+package slip
+
+import (
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/internal/flat"
+	"io"
+)
+
+const (
+	// BufferSize the count of bytes the buffer can hold
+	BufferSize = 512
+	// END ends a packet, RFC 1055
+	END = 0xC0
+	// ESC starts a two byte escape sequence
+	ESC = 0xDB
+	// ESCEND an escaped END, follows ESC
+	ESCEND = 0xDC
+	// ESCESC an escaped ESC, follows ESC
+	ESCESC = 0xDD
+)
+
+// Protocol frames messages as RFC 1055 SLIP
+// packets. With LeadingEND every packet also
+// starts with an END, flushing any line noise
+// the peer received before it
+type Protocol struct {
+	LeadingEND bool
+}
+
+// NewReader ...
+func (p *Protocol) NewReader(R io.Reader) io.Reader {
+	return NewReader(R)
+}
+
+// NewWriter ...
+func (p *Protocol) NewWriter(W io.Writer) io.Writer {
+	w := NewWriter(W)
+	w.LeadingEND = p.LeadingEND
+
+	return w
+}
+
+// NewProtocol ...
+func NewProtocol(LeadingEND bool) *Protocol {
+	p := Protocol{
+		LeadingEND: LeadingEND,
+	}
+
+	return &p
+}
+
+func init() {
+	proto.Register("slip", func() proto.Protocol {
+		return NewProtocol(true)
+	})
+}
+
+// Reader read messages using this Reader. Empty
+// packets, such as the one a leading END makes,
+// are dropped. An ESC before any byte other
+// than ESCEND or ESCESC leaves that byte as it
+// is, as RFC 1055 does. Messages past Max bytes
+// are skipped and return proto.ErrMessageTooLarge
+type Reader struct {
+	R       io.Reader
+	Buff    []byte
+	Pending []byte
+	Escape  bool
+	Started bool
+	Err     error
+	Max     int
+	Size    int
+}
+
+// Writer encode messages using this Writer
+type Writer struct {
+	W          io.Writer
+	LeadingEND bool
+	Open       bool
+
+	flat flat.Buffer
+}
+
+// NewReader creates a new Reader that
+// will decode messages from an io.Reader
+func NewReader(R io.Reader) *Reader {
+	r := Reader{
+		R:    R,
+		Buff: make([]byte, BufferSize),
+	}
+
+	return &r
+}
+
+// NewWriter creates a new Writer that
+// will encode messages to an io.Writer
+func NewWriter(W io.Writer) *Writer {
+	w := Writer{
+		W: W,
+	}
+
+	w.flat.Encode = w.message
+
+	return &w
+}
+
+// Read decodes bytes into b, it returns
+// proto.ErrEOM when it reaches an END
+func (r *Reader) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	for {
+		for len(r.Pending) == 0 {
+			if r.Err == io.EOF && r.Started {
+				return 0, io.ErrUnexpectedEOF
+			}
+
+			if r.Err != nil {
+				return 0, r.readErr()
+			}
+
+			n, err := r.R.Read(r.Buff)
+
+			r.Pending = r.Buff[:n]
+			r.Err = err
+		}
+
+		n, err := r.decode(b)
+
+		r.Size += n
+
+		if r.Max > 0 && r.Size > r.Max {
+			return 0, r.skip()
+		}
+
+		if err == proto.ErrEOM {
+			r.Size = 0
+		}
+
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// SetMaxMessageSize ...
+func (r *Reader) SetMaxMessageSize(Max int) {
+	r.Max = Max
+}
+
+// readErr hands back the read error, only io.EOF
+// is kept so a read past a deadline can be retried
+func (r *Reader) readErr() error {
+	err := r.Err
+
+	if err != io.EOF {
+		r.Err = nil
+	}
+
+	return err
+}
+
+// skip drops the rest of a message past Max
+// up to its END, an escaped END is never
+// the byte itself
+func (r *Reader) skip() error {
+	for {
+		for i, c := range r.Pending {
+			if c == END {
+				r.Pending = r.Pending[i+1:]
+				r.Escape = false
+				r.Started = false
+				r.Size = 0
+
+				return proto.ErrMessageTooLarge
+			}
+		}
+
+		r.Pending = nil
+
+		if r.Err != nil {
+			return r.readErr()
+		}
+
+		n, err := r.R.Read(r.Buff)
+
+		r.Pending = r.Buff[:n]
+		r.Err = err
+	}
+}
+
+// decode moves the pending bytes into b
+// it stops early at an END
+func (r *Reader) decode(b []byte) (int, error) {
+	i := 0
+	n := 0
+
+	for i < len(r.Pending) && n < len(b) {
+		c := r.Pending[i]
+
+		if c == END {
+			// hand back the bytes before the END
+			// first, the next Read returns EOM
+			if n > 0 {
+				break
+			}
+
+			r.Pending = r.Pending[i+1:]
+			r.Escape = false
+
+			// an empty packet is not a message
+			if !r.Started {
+				i = 0
+
+				continue
+			}
+
+			r.Started = false
+
+			return 0, proto.ErrEOM
+		}
+
+		r.Started = true
+		i++
+
+		if r.Escape {
+			r.Escape = false
+
+			switch c {
+			case ESCEND:
+				c = END
+
+			case ESCESC:
+				c = ESC
+			}
+		} else if c == ESC {
+			r.Escape = true
+
+			continue
+		}
+
+		b[n] = c
+		n++
+	}
+
+	r.Pending = r.Pending[i:]
+
+	return n, nil
+}
+
+// Write encodes the bytes to the underlying
+// writer, writing the nil buffer or the empty
+// buffer writes the END
+func (w *Writer) Write(b []byte) (int, error) {
+	Flat := w.flat.Bytes()
+
+	if len(b) == 0 {
+		Flat = w.end(Flat)
+	} else {
+		Flat = w.encode(Flat, b)
+	}
+
+	_, err := w.flat.Write(w.W, Flat)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// WriteMessage writes the whole message
+// in a single write
+func (w *Writer) WriteMessage(b []byte) (int, error) {
+	return w.flat.WriteMessages(w.W, b)
+}
+
+// WriteMessages writes every message
+// in a single write
+func (w *Writer) WriteMessages(msgs ...[]byte) (int, error) {
+	return w.flat.WriteMessages(w.W, msgs...)
+}
+
+// message appends the whole packet
+func (w *Writer) message(Flat []byte, m []byte) ([]byte, error) {
+	return w.end(w.encode(Flat, m)), nil
+}
+
+// encode appends the escaped bytes, a message
+// starts with an END when LeadingEND is set
+func (w *Writer) encode(Flat []byte, b []byte) []byte {
+	if !w.Open && w.LeadingEND {
+		Flat = append(Flat, END)
+	}
+
+	w.Open = true
+
+	for _, c := range b {
+		switch c {
+		case END:
+			Flat = append(Flat, ESC, ESCEND)
+
+		case ESC:
+			Flat = append(Flat, ESC, ESCESC)
+
+		default:
+			Flat = append(Flat, c)
+		}
+	}
+
+	return Flat
+}
+
+// end appends the END of the message. SLIP can
+// not carry an empty message, its packet is
+// dropped by the reader
+func (w *Writer) end(Flat []byte) []byte {
+	w.Open = false
+
+	return append(Flat, END)
+}
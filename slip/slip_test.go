@@ -0,0 +1,218 @@
+package slip
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/johnmcconnell/proto"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"testing"
+	"testing/iotest"
+)
+
+// flaky fails its first read like a
+// read past a deadline
+type flaky struct {
+	R      io.Reader
+	Failed bool
+}
+
+func (f *flaky) Read(b []byte) (int, error) {
+	if !f.Failed {
+		f.Failed = true
+
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	return f.R.Read(b)
+}
+
+func randomBytes(S int) ([]byte, error) {
+	BS := make([]byte, S)
+
+	_, err := rand.Read(BS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return BS, err
+}
+
+func TestEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	M := []byte{0x01, END, 0x02, ESC, 0x03}
+
+	B := bytes.NewBuffer(nil)
+
+	proto.WriteMessage(NewWriter(B), M)
+
+	assert.Equal(
+		[]byte{0x01, ESC, ESCEND, 0x02, ESC, ESCESC, 0x03, END},
+		B.Bytes(),
+		"END and ESC are escaped",
+	)
+
+	B.Reset()
+
+	W := NewProtocol(true).NewWriter(B)
+
+	W.Write(M[:2])
+	W.Write(M[2:])
+	W.Write(nil)
+
+	proto.WriteMessages(W, []byte{0x04})
+
+	assert.Equal(
+		[]byte{END, 0x01, ESC, ESCEND, 0x02, ESC, ESCESC, 0x03, END, END, 0x04, END},
+		B.Bytes(),
+		"every packet starts with an END",
+	)
+}
+
+func TestDecoding(t *testing.T) {
+	assert := assert.New(t)
+
+	// line noise, then a leading END, then a packet
+	In := []byte{0x55, 0x66, END, END, 0x01, ESC, ESCEND, 0x02, ESC, ESCESC, END, END, 0x03, END}
+
+	for _, R := range []io.Reader{bytes.NewReader(In), iotest.OneByteReader(bytes.NewReader(In))} {
+		D := NewReader(R)
+
+		for _, m := range [][]byte{{0x55, 0x66}, {0x01, END, 0x02, ESC}, {0x03}} {
+			Received, err := proto.ReadMessage(D)
+
+			assert.Nil(
+				err,
+				"bytes not read",
+			)
+
+			assert.Equal(
+				m,
+				Received,
+				"bytes match and empty packets are dropped",
+			)
+		}
+
+		_, err := D.Read(make([]byte, 16))
+
+		assert.Equal(
+			io.EOF,
+			err,
+			"the stream is over",
+		)
+	}
+
+	Received, err := proto.ReadMessage(NewReader(bytes.NewReader([]byte{ESC, 0x41, END})))
+
+	assert.Nil(
+		err,
+		"bytes not read",
+	)
+
+	assert.Equal(
+		[]byte{0x41},
+		Received,
+		"a bad escape leaves the byte as it is",
+	)
+
+	_, err = proto.ReadMessage(NewReader(bytes.NewReader([]byte{0x01, 0x02})))
+
+	assert.Equal(
+		io.ErrUnexpectedEOF,
+		err,
+		"the stream ends inside a packet",
+	)
+}
+
+func TestRandom(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, LeadingEND := range []bool{false, true} {
+		B := bytes.NewBuffer(nil)
+		W, R := proto.Wrap(NewProtocol(LeadingEND), B, B)
+
+		var Messages [][]byte
+
+		for _, S := range []int{1, 100, 1000, 100000} {
+			m, err := randomBytes(S)
+
+			assert.Nil(
+				err,
+				"could not create random bytes",
+			)
+
+			Messages = append(Messages, m)
+		}
+
+		proto.WriteMessages(W, Messages...)
+
+		for _, m := range Messages {
+			Received, err := proto.ReadMessage(R)
+
+			assert.Nil(
+				err,
+				"bytes not read",
+			)
+
+			assert.True(
+				bytes.Equal(m, Received),
+				"bytes match",
+			)
+		}
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+	W, R := proto.Wrap(NewProtocol(true), B, B)
+
+	proto.WriteMessages(W, []byte("small"), bytes.Repeat([]byte{END}, 1000), []byte("again"))
+
+	R = proto.LimitMessages(R, 100)
+
+	for _, E := range []error{nil, proto.ErrMessageTooLarge, nil} {
+		_, err := proto.ReadMessage(R)
+
+		assert.Equal(
+			E,
+			err,
+			"messages past the max are skipped",
+		)
+	}
+}
+
+func TestReadAfterTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+
+	proto.WriteMessage(NewWriter(B), []byte("after"))
+
+	R := NewReader(&flaky{R: B})
+
+	_, err := proto.ReadMessage(R)
+
+	assert.Equal(
+		os.ErrDeadlineExceeded,
+		err,
+		"the read timed out",
+	)
+
+	Received, err := proto.ReadMessage(R)
+
+	assert.Nil(
+		err,
+		"the reader recovers from a timeout",
+	)
+
+	assert.Equal(
+		"after",
+		string(Received),
+		"bytes match",
+	)
+}
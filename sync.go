@@ -0,0 +1,61 @@
+package proto
+
+import (
+	"io"
+	"sync"
+)
+
+// SyncWriter makes a message writer safe for use by
+// many goroutines. WriteMessage and WriteMessages
+// hold the lock for whole messages so they go out
+// in one piece. A message written with several
+// Write calls can still interleave with others
+type SyncWriter struct {
+	W  io.Writer
+	mu sync.Mutex
+}
+
+// NewSyncWriter ...
+func NewSyncWriter(W io.Writer) *SyncWriter {
+	w := SyncWriter{
+		W: W,
+	}
+
+	return &w
+}
+
+// Write writes to W while holding the lock
+func (w *SyncWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.W.Write(b)
+}
+
+// WriteMessage writes the whole message and its
+// end of message while holding the lock
+func (w *SyncWriter) WriteMessage(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return WriteMessage(w.W, b)
+}
+
+// WriteMessages writes every message while
+// holding the lock
+func (w *SyncWriter) WriteMessages(msgs ...[]byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return WriteMessages(w.W, msgs...)
+}
+
+// Flush flushes W if it buffers, a buffered
+// writer has a lock of its own
+func (w *SyncWriter) Flush() error {
+	if f, ok := w.W.(Flusher); ok {
+		return f.Flush()
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package proto_test
+
+import (
+	"bytes"
+	"github.com/johnmcconnell/proto"
+	"github.com/johnmcconnell/proto/crc"
+	"github.com/johnmcconnell/proto/qik"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentWriteMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	// crc writes a message with several writes
+	for _, p := range []proto.Protocol{qik.NewProtocol(), crc.NewProtocol(qik.NewProtocol())} {
+		a, b := net.Pipe()
+
+		A := proto.WrapConn(p, a)
+		B := proto.WrapConn(p, b)
+
+		const N = 8
+		const M = 20
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < N; i++ {
+			wg.Add(1)
+
+			// large enough to take several qik frames
+			m := bytes.Repeat([]byte{byte('a' + i)}, 100*1000)
+
+			go func() {
+				defer wg.Done()
+
+				for j := 0; j < M; j++ {
+					proto.WriteMessage(A, m)
+				}
+			}()
+		}
+
+		for i := 0; i < N*M; i++ {
+			Received, err := proto.ReadMessage(B)
+
+			assert.Nil(
+				err,
+				"bytes not read",
+			)
+
+			assert.Equal(
+				bytes.Repeat(Received[:1], 100*1000),
+				Received,
+				"the message was not interleaved",
+			)
+		}
+
+		wg.Wait()
+
+		A.Close()
+		B.Close()
+	}
+}
+
+func TestSyncWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	B := bytes.NewBuffer(nil)
+	W := proto.NewSyncWriter(qik.NewWriter(B))
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			proto.WriteMessages(W, []byte("one"), []byte("two"))
+		}()
+	}
+
+	wg.Wait()
+
+	R := qik.NewReader(B)
+
+	for i := 0; i < 4; i++ {
+		for _, m := range []string{"one", "two"} {
+			Received, err := proto.ReadMessage(R)
+
+			assert.Nil(
+				err,
+				"bytes not read",
+			)
+
+			assert.Equal(
+				m,
+				string(Received),
+				"batches were not interleaved",
+			)
+		}
+	}
+}